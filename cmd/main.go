@@ -26,6 +26,8 @@ import (
 )
 
 func main() {
+	// A config profile gives way to the env of the process but not to .env
+	pkg.RecordEnv()
 	err := godotenv.Load()
 	if err != nil {
 		show.Error("Error loading .env file")
@@ -3,16 +3,19 @@ module clickhouse-benchmark
 go 1.19
 
 require (
+	github.com/ClickHouse/ch-go v0.52.1
 	github.com/ClickHouse/clickhouse-go/v2 v2.10.1
 	github.com/cheggaaa/pb/v3 v3.1.2
 	github.com/google/uuid v1.3.0
 	github.com/joho/godotenv v1.5.1
 	github.com/montanaflynn/stats v0.7.1
+	github.com/shopspring/decimal v1.3.1
 	github.com/spf13/cobra v1.7.0
+	github.com/spf13/pflag v1.0.5
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
-	github.com/ClickHouse/ch-go v0.52.1 // indirect
 	github.com/VividCortex/ewma v1.2.0 // indirect
 	github.com/andybalholm/brotli v1.0.5 // indirect
 	github.com/fatih/color v1.14.1 // indirect
@@ -28,10 +31,7 @@ require (
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/rivo/uniseg v0.2.0 // indirect
 	github.com/segmentio/asm v1.2.0 // indirect
-	github.com/shopspring/decimal v1.3.1 // indirect
-	github.com/spf13/pflag v1.0.5 // indirect
 	go.opentelemetry.io/otel v1.13.0 // indirect
 	go.opentelemetry.io/otel/trace v1.13.0 // indirect
 	golang.org/x/sys v0.5.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,89 @@
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"clickhouse-benchmark/pkg/show"
+
+	ck "github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+// Async insert modes of the write benchmark
+const (
+	asyncInsertOff    = "off"
+	asyncInsertWait   = "wait"   // the server acknowledges once the buffer is flushed
+	asyncInsertNoWait = "nowait" // the server acknowledges once the rows are buffered
+)
+
+// insertContext carries the settings and the async insert settings of the inserts
+func (o *WriteOption) insertContext() context.Context {
+	ctx := context.Background()
+	settings := mergeSettings(o.querySettings)
+	if o.asyncInsert != asyncInsertOff && o.asyncInsert != "" {
+		wait := 1
+		if o.asyncInsert == asyncInsertNoWait {
+			wait = 0
+		}
+		settings = mergeSettings(settings, ck.Settings{
+			"async_insert":          1,
+			"wait_for_async_insert": wait,
+		})
+	}
+	if len(settings) == 0 {
+		return ctx
+	}
+	return ck.Context(ctx, ck.WithSettings(settings))
+}
+
+// insertTable returns the table the rows are written to
+func (o *WriteOption) insertTable() (string, string) {
+	if o.target != nil {
+		return o.target.database, o.target.table
+	}
+	return databaseName, tableName
+}
+
+// countRows counts the rows of a table, other writers of the table are counted too
+func countRows(conn driver.Conn, database, table string) (uint64, error) {
+	var count uint64
+	query := fmt.Sprintf("SELECT count() FROM `%s`.`%s`", database, table)
+	if err := conn.QueryRow(context.Background(), query).Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// visibleRows waits for the server buffers to flush and returns how many rows
+// the table gained since before was counted
+func visibleRows(conn driver.Conn, opt *WriteOption, before uint64) (int64, error) {
+	show.Info("Waiting %v for async inserts to flush", opt.asyncFlushWait)
+	time.Sleep(opt.asyncFlushWait)
+
+	database, table := opt.insertTable()
+	after, err := countRows(conn, database, table)
+	if err != nil {
+		return 0, err
+	}
+	return int64(after) - int64(before), nil
+}
@@ -3,21 +3,49 @@ package clickhouse
 import (
 	"context"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
 )
 
+// Sizer is implemented by rows that know their uncompressed size
+type Sizer interface {
+	Size() int
+}
+
 type Batch struct {
 	driver.Batch
-	totalRows int // Total number of rows in the batch
+	totalRows  int       // Total number of rows in the batch
+	totalBytes int       // Uncompressed size of the rows that implement Sizer
+	created    time.Time // When the batch was prepared
+}
+
+// Prepare prepares a batch for all columns of the table, ctx carries the query settings
+func Prepare(ctx context.Context, conn driver.Conn, databaseName, tableName string) (*Batch, error) {
+	return prepare(ctx, conn, fmt.Sprintf("INSERT INTO %s.%s", databaseName, tableName))
 }
 
-func Prepare(conn driver.Conn, databaseName, tableName string) (*Batch, error) {
-	batch, err := conn.PrepareBatch(context.Background(), fmt.Sprintf("INSERT INTO %s.%s", databaseName, tableName))
+// PrepareColumns prepares a batch that only inserts the given columns
+func PrepareColumns(ctx context.Context, conn driver.Conn, databaseName, tableName string, columns []string) (*Batch, error) {
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = quote(column)
+	}
+	return prepare(ctx, conn, fmt.Sprintf("INSERT INTO %s.%s (%s)", quote(databaseName), quote(tableName), strings.Join(quoted, ", ")))
+}
+
+// quote quotes an identifier with backticks
+func quote(identifier string) string {
+	return "`" + strings.ReplaceAll(identifier, "`", "\\`") + "`"
+}
+
+func prepare(ctx context.Context, conn driver.Conn, query string) (*Batch, error) {
+	batch, err := conn.PrepareBatch(ctx, query)
 	if err != nil {
 		return nil, err
 	}
-	b := &Batch{}
+	b := &Batch{created: time.Now()}
 	b.Batch = batch
 	return b, nil
 }
@@ -28,15 +56,51 @@ func (b *Batch) AppendStruct(s interface{}) error {
 	if err == nil {
 		//b.Increment()
 		b.totalRows++
+		if sizer, ok := s.(Sizer); ok {
+			b.totalBytes += sizer.Size()
+		}
+	}
+	return err
+}
+
+// AppendRow appends the values of one row and counts size as its uncompressed bytes
+func (b *Batch) AppendRow(size int, values ...interface{}) error {
+	err := b.Batch.Append(values...)
+	if err == nil {
+		b.totalRows++
+		b.totalBytes += size
 	}
 	return err
 }
 
+// AppendColumns appends whole columns in the order of the insert, rows and
+// size describe all of them together
+func (b *Batch) AppendColumns(rows, size int, columns ...interface{}) error {
+	for i, column := range columns {
+		if err := b.Batch.Column(i).Append(column); err != nil {
+			return err
+		}
+	}
+	b.totalRows += rows
+	b.totalBytes += size
+	return nil
+}
+
 // TotalRows returns the total number of rows in the batch
 func (b *Batch) TotalRows() int {
 	return b.totalRows
 }
 
+// TotalBytes returns the uncompressed size of the rows in the batch
+func (b *Batch) TotalBytes() int {
+	return b.totalBytes
+}
+
+// Age returns how long ago the batch was prepared
+func (b *Batch) Age() time.Duration {
+	return time.Since(b.created)
+}
+
 // Send sends the batch for execution and resets the total rows count
 func (b *Batch) Send() error {
 	if b.Batch.IsSent() {
@@ -45,6 +109,7 @@ func (b *Batch) Send() error {
 	err := b.Batch.Send()
 	if err == nil {
 		b.totalRows = 0
+		b.totalBytes = 0
 	}
 	return err
 }
@@ -0,0 +1,245 @@
+package clickhouse
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	ck "github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/proto"
+)
+
+// RowValues is implemented by rows that can be inserted over HTTP, they
+// return their values in the column order of the insert
+type RowValues interface {
+	RowValues() []interface{}
+}
+
+// OpenHTTP opens a connection to the HTTP interface. The driver only talks
+// HTTP through database/sql, httpConn adapts it to driver.Conn.
+func OpenHTTP(options *ck.Options) driver.Conn {
+	// database/sql owns the pool, the driver refuses pool options
+	maxIdle, maxOpen, maxLifetime := options.MaxIdleConns, options.MaxOpenConns, options.ConnMaxLifetime
+	options.MaxIdleConns, options.MaxOpenConns, options.ConnMaxLifetime = 0, 0, 0
+	options.Protocol = ck.HTTP
+
+	db := ck.OpenDB(options)
+	db.SetMaxIdleConns(maxIdle)
+	db.SetMaxOpenConns(maxOpen)
+	db.SetConnMaxLifetime(maxLifetime)
+	return &httpConn{db: db}
+}
+
+func errUnsupported(operation string) error {
+	return fmt.Errorf("%s is not supported over HTTP", operation)
+}
+
+type httpConn struct {
+	db *sql.DB
+}
+
+func (c *httpConn) Contributors() []string {
+	return nil
+}
+
+func (c *httpConn) ServerVersion() (*driver.ServerVersion, error) {
+	var version, timezone, hostname string
+	row := c.db.QueryRow("SELECT version(), timezone(), hostName()")
+	if err := row.Scan(&version, &timezone, &hostname); err != nil {
+		return nil, err
+	}
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		location = time.UTC
+	}
+	return &driver.ServerVersion{
+		Name:        "ClickHouse",
+		DisplayName: hostname,
+		Version:     proto.ParseVersion(version),
+		Timezone:    location,
+	}, nil
+}
+
+func (c *httpConn) Select(ctx context.Context, dest any, query string, args ...any) error {
+	return errUnsupported("Select")
+}
+
+func (c *httpConn) Query(ctx context.Context, query string, args ...any) (driver.Rows, error) {
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return &httpRows{Rows: rows}, nil
+}
+
+func (c *httpConn) QueryRow(ctx context.Context, query string, args ...any) driver.Row {
+	return &httpRow{Row: c.db.QueryRowContext(ctx, query, args...)}
+}
+
+// PrepareBatch opens a transaction, the driver sends the rows on commit. The
+// driver parses the table and the columns out of the query without quotes,
+// so the identifiers quoted by PrepareColumns are unquoted.
+func (c *httpConn) PrepareBatch(ctx context.Context, query string) (driver.Batch, error) {
+	query = unquote(query)
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return &httpBatch{ctx: ctx, tx: tx, stmt: stmt}, nil
+}
+
+// unquote drops the backticks around the identifiers of the query and
+// unescapes what quote escaped inside them
+func unquote(query string) string {
+	var (
+		b      strings.Builder
+		quoted bool
+	)
+	for i := 0; i < len(query); i++ {
+		switch c := query[i]; {
+		case quoted && c == '\\' && i+1 < len(query):
+			i++
+			b.WriteByte(query[i])
+		case c == '`':
+			quoted = !quoted
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func (c *httpConn) Exec(ctx context.Context, query string, args ...any) error {
+	_, err := c.db.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (c *httpConn) AsyncInsert(ctx context.Context, query string, wait bool) error {
+	_, err := c.db.ExecContext(ck.Context(ctx, ck.WithStdAsync(wait)), query)
+	return err
+}
+
+func (c *httpConn) Ping(ctx context.Context) error {
+	return c.db.PingContext(ctx)
+}
+
+func (c *httpConn) Stats() driver.Stats {
+	stats := c.db.Stats()
+	return driver.Stats{
+		MaxOpenConns: stats.MaxOpenConnections,
+		Open:         stats.OpenConnections,
+		Idle:         stats.Idle,
+	}
+}
+
+func (c *httpConn) Close() error {
+	return c.db.Close()
+}
+
+type httpRow struct {
+	*sql.Row
+}
+
+func (r *httpRow) ScanStruct(dest any) error {
+	return errUnsupported("ScanStruct")
+}
+
+type httpRows struct {
+	*sql.Rows
+}
+
+func (r *httpRows) ScanStruct(dest any) error {
+	return errUnsupported("ScanStruct")
+}
+
+func (r *httpRows) Totals(dest ...any) error {
+	return errUnsupported("Totals")
+}
+
+func (r *httpRows) Columns() []string {
+	columns, _ := r.Rows.Columns()
+	return columns
+}
+
+func (r *httpRows) ColumnTypes() []driver.ColumnType {
+	types, _ := r.Rows.ColumnTypes()
+	columnTypes := make([]driver.ColumnType, len(types))
+	for i, typ := range types {
+		columnTypes[i] = httpColumnType{typ}
+	}
+	return columnTypes
+}
+
+type httpColumnType struct {
+	*sql.ColumnType
+}
+
+func (t httpColumnType) Nullable() bool {
+	nullable, _ := t.ColumnType.Nullable()
+	return nullable
+}
+
+type httpBatch struct {
+	ctx  context.Context
+	tx   *sql.Tx
+	stmt *sql.Stmt
+	sent bool
+}
+
+func (b *httpBatch) Abort() error {
+	if b.sent {
+		return errors.New("batch has already been sent")
+	}
+	b.sent = true
+	return b.tx.Rollback()
+}
+
+func (b *httpBatch) Append(v ...any) error {
+	_, err := b.stmt.ExecContext(b.ctx, v...)
+	return err
+}
+
+func (b *httpBatch) AppendStruct(v any) error {
+	row, ok := v.(RowValues)
+	if !ok {
+		return fmt.Errorf("%T does not implement RowValues", v)
+	}
+	return b.Append(row.RowValues()...)
+}
+
+func (b *httpBatch) Column(int) driver.BatchColumn {
+	return httpColumn{}
+}
+
+func (b *httpBatch) Flush() error {
+	return nil
+}
+
+func (b *httpBatch) Send() error {
+	b.sent = true
+	return b.tx.Commit()
+}
+
+func (b *httpBatch) IsSent() bool {
+	return b.sent
+}
+
+// httpColumn refuses column appends, database/sql only takes rows
+type httpColumn struct{}
+
+func (httpColumn) Append(any) error {
+	return errUnsupported("column append")
+}
+
+func (httpColumn) AppendRow(any) error {
+	return errUnsupported("column append")
+}
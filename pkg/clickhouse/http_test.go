@@ -0,0 +1,240 @@
+package clickhouse
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	chproto "github.com/ClickHouse/ch-go/proto"
+	ck "github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/column"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/proto"
+)
+
+// stubServer answers the few queries the driver and the tests send in the
+// Native format of the HTTP interface and records the inserted rows
+type stubServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	queries  []string
+	inserts  []string
+	columns  []string
+	inserted int
+}
+
+func newStubServer(t *testing.T) *stubServer {
+	s := &stubServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := s.serve(w, r); err != nil {
+			t.Errorf("stub: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *stubServer) serve(w http.ResponseWriter, r *http.Request) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Inserts carry the query in the URL and the rows as Native blocks in the body
+	if query := r.URL.Query().Get("query"); query != "" {
+		s.inserts = append(s.inserts, query)
+		reader := chproto.NewReader(r.Body)
+		for {
+			block := proto.Block{}
+			if err := block.Decode(reader, 0); err != nil {
+				if errors.Is(err, io.EOF) {
+					return nil
+				}
+				return err
+			}
+			if block.Rows() > 0 {
+				s.columns = block.ColumnsNames()
+				s.inserted += block.Rows()
+			}
+		}
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	query := strings.TrimSpace(string(body))
+	s.queries = append(s.queries, query)
+
+	var block *proto.Block
+	switch {
+	case query == "SELECT timezone()":
+		block, err = nativeBlock([]string{"timezone()"}, []string{"String"}, []any{"UTC"})
+	case query == "SELECT version()":
+		block, err = nativeBlock([]string{"version()"}, []string{"String"}, []any{"23.3.1.1"})
+	case strings.HasPrefix(query, "DESCRIBE TABLE"):
+		names := []string{"name", "type", "default_type", "default_expression", "comment", "codec_expression", "ttl_expression"}
+		types := []string{"String", "String", "String", "String", "String", "String", "String"}
+		block, err = nativeBlock(names, types,
+			[]any{"id", "UInt64", "", "", "", "", ""},
+			[]any{"name", "String", "", "", "", "", ""},
+			[]any{"na`me", "String", "", "", "", "", ""})
+	case query == "SELECT number FROM numbers(3)":
+		block, err = nativeBlock([]string{"number"}, []string{"UInt64"}, []any{uint64(0)}, []any{uint64(1)}, []any{uint64(2)})
+	default:
+		return errors.New("unexpected query: " + query)
+	}
+	if err != nil {
+		return err
+	}
+
+	buffer := &chproto.Buffer{}
+	if err := block.Encode(buffer, 0); err != nil {
+		return err
+	}
+	_, err = w.Write(buffer.Buf)
+	return err
+}
+
+func nativeBlock(names, types []string, rows ...[]any) (*proto.Block, error) {
+	block := &proto.Block{}
+	for i, name := range names {
+		if err := block.AddColumn(name, column.Type(types[i])); err != nil {
+			return nil, err
+		}
+	}
+	for _, row := range rows {
+		if err := block.Append(row...); err != nil {
+			return nil, err
+		}
+	}
+	return block, nil
+}
+
+type stubRow struct {
+	id   uint64
+	name string
+}
+
+func (r *stubRow) RowValues() []interface{} {
+	return []interface{}{r.id, r.name}
+}
+
+func TestOpenHTTPQuery(t *testing.T) {
+	stub := newStubServer(t)
+	conn := OpenHTTP(&ck.Options{Addr: []string{strings.TrimPrefix(stub.URL, "http://")}})
+	defer conn.Close()
+
+	rows, err := conn.Query(context.Background(), "SELECT number FROM numbers(3)")
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	defer rows.Close()
+	if columns := rows.Columns(); len(columns) != 1 || columns[0] != "number" {
+		t.Errorf("columns = %v, want [number]", columns)
+	}
+
+	var numbers []uint64
+	for rows.Next() {
+		var number uint64
+		if err := rows.Scan(&number); err != nil {
+			t.Fatalf("Scan: %v", err)
+		}
+		numbers = append(numbers, number)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("Rows: %v", err)
+	}
+	if len(numbers) != 3 || numbers[0] != 0 || numbers[2] != 2 {
+		t.Errorf("numbers = %v, want [0 1 2]", numbers)
+	}
+}
+
+func TestOpenHTTPBatch(t *testing.T) {
+	stub := newStubServer(t)
+	conn := OpenHTTP(&ck.Options{Addr: []string{strings.TrimPrefix(stub.URL, "http://")}})
+	defer conn.Close()
+
+	// PrepareColumns quotes the identifiers like every insert of the tool
+	batch, err := PrepareColumns(context.Background(), conn, "test", "metrics", []string{"id", "name"})
+	if err != nil {
+		t.Fatalf("PrepareColumns: %v", err)
+	}
+	if err := batch.AppendRow(9, uint64(1), "first"); err != nil {
+		t.Fatalf("AppendRow: %v", err)
+	}
+	if err := batch.AppendStruct(&stubRow{id: 2, name: "second"}); err != nil {
+		t.Fatalf("AppendStruct: %v", err)
+	}
+	if err := batch.Column(0).Append([]uint64{3}); err == nil {
+		t.Errorf("column append over HTTP should fail")
+	}
+	if err := batch.Send(); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if !batch.IsSent() {
+		t.Errorf("batch is not sent")
+	}
+
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	if stub.inserted != 2 {
+		t.Errorf("inserted %d rows, want 2", stub.inserted)
+	}
+	if len(stub.inserts) != 1 || stub.inserts[0] != "INSERT INTO test.metrics FORMAT Native" {
+		t.Errorf("inserts = %q", stub.inserts)
+	}
+	if strings.Join(stub.columns, ",") != "id,name" {
+		t.Errorf("inserted columns = %v, want [id name]", stub.columns)
+	}
+	var described bool
+	for _, query := range stub.queries {
+		described = described || query == "DESCRIBE TABLE test.metrics"
+	}
+	if !described {
+		t.Errorf("queries = %q, want DESCRIBE TABLE test.metrics", stub.queries)
+	}
+}
+
+func TestOpenHTTPBatchQuotedColumn(t *testing.T) {
+	stub := newStubServer(t)
+	conn := OpenHTTP(&ck.Options{Addr: []string{strings.TrimPrefix(stub.URL, "http://")}})
+	defer conn.Close()
+
+	batch, err := PrepareColumns(context.Background(), conn, "test", "metrics", []string{"id", "na`me"})
+	if err != nil {
+		t.Fatalf("PrepareColumns: %v", err)
+	}
+	if err := batch.AppendRow(9, uint64(1), "first"); err != nil {
+		t.Fatalf("AppendRow: %v", err)
+	}
+	if err := batch.Send(); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	if strings.Join(stub.columns, ",") != "id,na`me" {
+		t.Errorf("inserted columns = %q, want [id na`me]", stub.columns)
+	}
+}
+
+func TestUnquote(t *testing.T) {
+	tests := []struct {
+		query, want string
+	}{
+		{"INSERT INTO `test`.`metrics` (`id`, `name`)", "INSERT INTO test.metrics (id, name)"},
+		{"INSERT INTO `test`.`metrics` (`id`, `na\\`me`)", "INSERT INTO test.metrics (id, na`me)"},
+		{"INSERT INTO `test`.`metrics` (`a\\\\b`)", "INSERT INTO test.metrics (a\\b)"},
+		{"INSERT INTO test.metrics", "INSERT INTO test.metrics"},
+	}
+	for _, test := range tests {
+		if got := unquote(test.query); got != test.want {
+			t.Errorf("unquote(%q) = %q, want %q", test.query, got, test.want)
+		}
+	}
+}
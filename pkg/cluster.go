@@ -0,0 +1,309 @@
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"clickhouse-benchmark/pkg/report"
+	"clickhouse-benchmark/pkg/show"
+
+	ck "github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+// shardSkewWarn is the spread of the shard row counts relative to their mean that gets a warning
+const shardSkewWarn = 0.1
+
+// clusterNode is a replica of system.clusters and what it holds of the table
+type clusterNode struct {
+	shard      uint32
+	replica    uint32
+	host       string
+	port       uint16
+	answered   bool // answered the clusterAllReplicas queries, missing ones count as empty
+	rows       uint64
+	bytes      uint64
+	parts      uint64
+	partitions uint64
+}
+
+// clusterDescription covers the table on every shard and replica of the cluster
+type clusterDescription struct {
+	name   string
+	nodes  []clusterNode // ordered by shard and replica
+	shards []uint32
+}
+
+// describeCluster queries the table on all replicas of the cluster, the
+// cluster is --cluster or the {cluster} macro of the server
+func describeCluster(conn driver.Conn) (*clusterDescription, error) {
+	name, err := clusterName(conn)
+	if err != nil || name == "" {
+		return nil, err
+	}
+
+	cluster := &clusterDescription{name: name}
+	if err := cluster.loadNodes(conn); err != nil {
+		return nil, err
+	}
+	if len(cluster.nodes) == 0 {
+		return nil, fmt.Errorf("cluster %s is not in system.clusters", name)
+	}
+
+	// Unreachable replicas are skipped and stay unanswered
+	ctx := ck.Context(context.Background(), ck.WithSettings(ck.Settings{"skip_unavailable_shards": 1}))
+	query := fmt.Sprintf("SELECT hostName(), FQDN(), tcpPort(), toUInt64(0), toUInt64(0), toUInt64(0), toUInt64(0) FROM clusterAllReplicas('%s', system.one)", name)
+	if err := cluster.loadParts(ctx, conn, query, false); err != nil {
+		return nil, err
+	}
+	query = fmt.Sprintf(`SELECT hostName() AS host, FQDN() AS fqdn, tcpPort() AS port,
+			toUInt64(sum(rows)), toUInt64(sum(bytes_on_disk)), toUInt64(count()), toUInt64(uniqExact(partition_id))
+		FROM clusterAllReplicas('%s', system.parts)
+		WHERE active AND database = '%s' AND table = '%s'
+		GROUP BY host, fqdn, port`, name, databaseName, tableName)
+	if err := cluster.loadParts(ctx, conn, query, true); err != nil {
+		return nil, err
+	}
+	return cluster, nil
+}
+
+// loadNodes lists the replicas of the cluster as configured
+func (c *clusterDescription) loadNodes(conn driver.Conn) error {
+	query := fmt.Sprintf("SELECT shard_num, replica_num, host_name, port FROM system.clusters WHERE cluster = '%s' ORDER BY shard_num, replica_num", c.name)
+	rows, err := conn.Query(context.Background(), query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var node clusterNode
+		if err := rows.Scan(&node.shard, &node.replica, &node.host, &node.port); err != nil {
+			return err
+		}
+		if len(c.shards) == 0 || c.shards[len(c.shards)-1] != node.shard {
+			c.shards = append(c.shards, node.shard)
+		}
+		c.nodes = append(c.nodes, node)
+	}
+	return rows.Err()
+}
+
+// loadParts matches the per server rows of the query to the configured
+// replicas, the query returns the host name, the FQDN, the TCP port and the
+// part stats
+func (c *clusterDescription) loadParts(ctx context.Context, conn driver.Conn, query string, stats bool) error {
+	rows, err := conn.Query(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			hostname, fqdn                  string
+			port                            uint16
+			count, bytes, parts, partitions uint64
+		)
+		if err := rows.Scan(&hostname, &fqdn, &port, &count, &bytes, &parts, &partitions); err != nil {
+			return err
+		}
+		node := c.node(hostname, fqdn, port)
+		if node == nil {
+			show.Warn("%s:%d answered for cluster %s but is not in system.clusters", fqdn, port, c.name)
+			continue
+		}
+		node.answered = true
+		if stats {
+			node.rows, node.bytes, node.parts, node.partitions = count, bytes, parts, partitions
+		}
+	}
+	return rows.Err()
+}
+
+// node finds the configured replica of a server by host and TCP port, the
+// configured name may be the short host name or the FQDN. One host may run
+// several replicas on different ports.
+func (c *clusterDescription) node(hostname, fqdn string, port uint16) *clusterNode {
+	for i := range c.nodes {
+		if c.nodes[i].port != port {
+			continue
+		}
+		configured := strings.ToLower(c.nodes[i].host)
+		for _, name := range []string{strings.ToLower(hostname), strings.ToLower(fqdn)} {
+			if name != "" && (configured == name || strings.HasPrefix(configured, name+".") || strings.HasPrefix(name, configured+".")) {
+				return &c.nodes[i]
+			}
+		}
+	}
+	return nil
+}
+
+func clusterName(conn driver.Conn) (string, error) {
+	if descOpt.cluster != "" {
+		return descOpt.cluster, nil
+	}
+	rows, err := conn.Query(context.Background(), "SELECT substitution FROM system.macros WHERE macro = 'cluster'")
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	var name string
+	for rows.Next() {
+		if err := rows.Scan(&name); err != nil {
+			return "", err
+		}
+	}
+	return name, rows.Err()
+}
+
+// replicas returns the answered nodes of the shard
+func (c *clusterDescription) replicas(shard uint32) []clusterNode {
+	var nodes []clusterNode
+	for _, node := range c.nodes {
+		if node.shard == shard && node.answered {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// answered counts the nodes that answered
+func (c *clusterDescription) answered() int {
+	var answered int
+	for _, node := range c.nodes {
+		if node.answered {
+			answered++
+		}
+	}
+	return answered
+}
+
+// shardRows is the row count of every shard, the most complete replica
+// counts and a shard without parts or answers has 0 rows
+func (c *clusterDescription) shardRows() []uint64 {
+	rows := make([]uint64, len(c.shards))
+	for i, shard := range c.shards {
+		for _, node := range c.replicas(shard) {
+			rows[i] = maxUint64(rows[i], node.rows)
+		}
+	}
+	return rows
+}
+
+// skew is the spread between the largest and the smallest shard relative to the mean shard
+func (c *clusterDescription) skew() float64 {
+	rows := c.shardRows()
+	if len(rows) < 2 {
+		return 0
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i] < rows[j] })
+	var total uint64
+	for _, count := range rows {
+		total += count
+	}
+	if total == 0 {
+		return 0
+	}
+	mean := float64(total) / float64(len(rows))
+	return float64(rows[len(rows)-1]-rows[0]) / mean
+}
+
+// divergence is the row difference between the replicas of the shard
+func (c *clusterDescription) divergence(shard uint32) (rows uint64, parts uint64) {
+	nodes := c.replicas(shard)
+	if len(nodes) < 2 {
+		return 0, 0
+	}
+	minRows, maxRows, minParts, maxParts := nodes[0].rows, nodes[0].rows, nodes[0].parts, nodes[0].parts
+	for _, node := range nodes[1:] {
+		minRows, maxRows = minUint64(minRows, node.rows), maxUint64(maxRows, node.rows)
+		minParts, maxParts = minUint64(minParts, node.parts), maxUint64(maxParts, node.parts)
+	}
+	return maxRows - minRows, maxParts - minParts
+}
+
+func minUint64(a, b uint64) uint64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func (c *clusterDescription) print() {
+	answered := c.answered()
+	show.Info("Cluster %s: %d shards, %d of %d replicas answered", c.name, len(c.shards), answered, len(c.nodes))
+	for _, node := range c.nodes {
+		if !node.answered {
+			show.Warn("shard %d, replica %d (%s:%d) did not answer, counted with 0 rows", node.shard, node.replica, node.host, node.port)
+			continue
+		}
+		show.Info("Shard %d, replica %d (%s:%d): rows: %d, disk: %.2f MB, parts: %d, partitions: %d",
+			node.shard, node.replica, node.host, node.port, node.rows, float64(node.bytes)/1024/1024, node.parts, node.partitions)
+	}
+
+	if len(c.shards) > 1 {
+		skew := c.skew()
+		show.Info("Shard row skew: %.1f%% of the mean shard", skew*100)
+		if skew > shardSkewWarn {
+			show.Warn("shards of %s.%s are skewed by %.1f%%, check the sharding key", databaseName, tableName, skew*100)
+		}
+	}
+	for _, shard := range c.shards {
+		if rows, parts := c.divergence(shard); rows > 0 || parts > 0 {
+			show.Warn("replicas of shard %d diverge by %d rows and %d parts", shard, rows, parts)
+		}
+	}
+}
+
+// addTo adds the nodes table and the skew metrics
+func (c *clusterDescription) addTo(document *report.Result) {
+	table := report.Table{Name: "nodes", Columns: []string{"shard", "replica", "host", "port", "answered", "rows", "bytes_on_disk", "parts", "partitions"}}
+	for _, node := range c.nodes {
+		table.Rows = append(table.Rows, []string{
+			strconv.FormatUint(uint64(node.shard), 10),
+			strconv.FormatUint(uint64(node.replica), 10),
+			node.host,
+			strconv.FormatUint(uint64(node.port), 10),
+			strconv.FormatBool(node.answered),
+			strconv.FormatUint(node.rows, 10),
+			strconv.FormatUint(node.bytes, 10),
+			strconv.FormatUint(node.parts, 10),
+			strconv.FormatUint(node.partitions, 10),
+		})
+	}
+	document.Tables = append(document.Tables, table)
+
+	var divergence uint64
+	for _, shard := range c.shards {
+		rows, _ := c.divergence(shard)
+		divergence = maxUint64(divergence, rows)
+	}
+	document.AddMetric("cluster_shards", float64(len(c.shards)), "shards", false)
+	document.AddMetric("cluster_replicas", float64(len(c.nodes)), "replicas", false)
+	document.AddMetric("cluster_replicas_answered", float64(c.answered()), "replicas", true)
+	document.AddMetric("shard_row_skew", c.skew(), "ratio", false)
+	document.AddMetric("max_replica_row_divergence", float64(divergence), "rows", false)
+}
@@ -0,0 +1,55 @@
+package pkg
+
+import "testing"
+
+func TestClusterSkewCountsEmptyShards(t *testing.T) {
+	cluster := &clusterDescription{name: "test", shards: []uint32{1, 2}, nodes: []clusterNode{
+		{shard: 1, replica: 1, host: "ch-1", answered: true, rows: 100},
+		{shard: 1, replica: 2, host: "ch-2", answered: true, rows: 90},
+		{shard: 2, replica: 1, host: "ch-3"},
+		{shard: 2, replica: 2, host: "ch-4", answered: true},
+	}}
+	if skew := cluster.skew(); skew != 2 {
+		t.Errorf("skew = %v, want 2", skew)
+	}
+	if rows, _ := cluster.divergence(1); rows != 10 {
+		t.Errorf("divergence of shard 1 = %d rows, want 10", rows)
+	}
+	if rows, _ := cluster.divergence(2); rows != 0 {
+		t.Errorf("divergence of shard 2 = %d rows, want 0, unanswered replicas are not compared", rows)
+	}
+	if answered := cluster.answered(); answered != 3 {
+		t.Errorf("answered = %d, want 3", answered)
+	}
+}
+
+func TestClusterNodeMatchesHost(t *testing.T) {
+	cluster := &clusterDescription{nodes: []clusterNode{
+		{shard: 1, replica: 1, host: "ch-1.example.com", port: 9000},
+		{shard: 1, replica: 2, host: "ch-2", port: 9000},
+		{shard: 2, replica: 1, host: "localhost", port: 9000},
+		{shard: 2, replica: 2, host: "localhost", port: 9001},
+	}}
+	tests := []struct {
+		hostname, fqdn string
+		port           uint16
+		shard, replica uint32
+	}{
+		{"ch-1", "ch-1.example.com", 9000, 1, 1},
+		{"CH-1", "", 9000, 1, 1},
+		{"ch-2", "ch-2.example.com", 9000, 1, 2},
+		{"ch-3", "ch-3.example.com", 9000, 0, 0},
+		{"ch-1", "ch-1.example.com", 9440, 0, 0},
+		{"localhost", "localhost", 9000, 2, 1},
+		{"localhost", "localhost", 9001, 2, 2},
+	}
+	for _, test := range tests {
+		node := cluster.node(test.hostname, test.fqdn, test.port)
+		switch {
+		case node == nil && test.replica != 0:
+			t.Errorf("%s:%d: no node, want shard %d replica %d", test.hostname, test.port, test.shard, test.replica)
+		case node != nil && (node.shard != test.shard || node.replica != test.replica):
+			t.Errorf("%s:%d: shard %d replica %d, want shard %d replica %d", test.hostname, test.port, node.shard, node.replica, test.shard, test.replica)
+		}
+	}
+}
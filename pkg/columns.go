@@ -0,0 +1,89 @@
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pkg
+
+import (
+	"time"
+)
+
+// Append modes of the write benchmark
+const (
+	structAppend = "struct"
+	columnAppend = "column"
+)
+
+// metricColumnNames are the columns of metricColumns in order
+var metricColumnNames = []string{
+	"timestamp", "metric_group",
+	"number_field_keys", "number_field_values",
+	"string_field_keys", "string_field_values",
+	"tag_keys", "tag_values",
+}
+
+// metricColumns buffers the metrics of a batch column by column, so the
+// batch gets one append per column instead of a reflected struct per row
+type metricColumns struct {
+	rows  int
+	bytes int
+
+	timestamps        []time.Time
+	metricGroups      []string
+	numberFieldKeys   [][]string
+	numberFieldValues [][]float64
+	stringFieldKeys   [][]string
+	stringFieldValues [][]string
+	tagKeys           [][]string
+	tagValues         [][]string
+}
+
+func (c *metricColumns) add(m *Metric) {
+	c.rows++
+	c.bytes += m.Size()
+	c.timestamps = append(c.timestamps, m.Timestamp)
+	c.metricGroups = append(c.metricGroups, m.MetricGroup)
+	c.numberFieldKeys = append(c.numberFieldKeys, m.NumberFieldKeys)
+	c.numberFieldValues = append(c.numberFieldValues, m.NumberFieldValues)
+	c.stringFieldKeys = append(c.stringFieldKeys, m.StringFieldKeys)
+	c.stringFieldValues = append(c.stringFieldValues, m.StringFieldValues)
+	c.tagKeys = append(c.tagKeys, m.TagKeys)
+	c.tagValues = append(c.tagValues, m.TagValues)
+}
+
+// values returns the columns in the order of metricColumnNames
+func (c *metricColumns) values() []interface{} {
+	return []interface{}{
+		c.timestamps, c.metricGroups,
+		c.numberFieldKeys, c.numberFieldValues,
+		c.stringFieldKeys, c.stringFieldValues,
+		c.tagKeys, c.tagValues,
+	}
+}
+
+// reset empties the columns but keeps their capacity for the next batch
+func (c *metricColumns) reset() {
+	c.rows, c.bytes = 0, 0
+	c.timestamps = c.timestamps[:0]
+	c.metricGroups = c.metricGroups[:0]
+	c.numberFieldKeys = c.numberFieldKeys[:0]
+	c.numberFieldValues = c.numberFieldValues[:0]
+	c.stringFieldKeys = c.stringFieldKeys[:0]
+	c.stringFieldValues = c.stringFieldValues[:0]
+	c.tagKeys = c.tagKeys[:0]
+	c.tagValues = c.tagValues[:0]
+}
@@ -0,0 +1,124 @@
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pkg
+
+import (
+	"fmt"
+	"math"
+	"os"
+
+	"clickhouse-benchmark/pkg/report"
+	"clickhouse-benchmark/pkg/show"
+
+	"github.com/spf13/cobra"
+)
+
+type compareOption struct {
+	thresholds []string
+	all        bool
+}
+
+var compareOpt compareOption
+
+var compareCommand = &cobra.Command{
+	Use:  "compare <base.json> <current.json>",
+	Long: ` compare two JSON result files and fail when a metric regressed beyond its threshold`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := compareResults(args[0], args[1]); err != nil {
+			show.Error("Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	root.AddCommand(compareCommand)
+
+	compareCommand.Flags().StringArrayVarP(&compareOpt.thresholds, "threshold", "t", nil, "largest allowed regression like '*latency_p99=10%', repeatable, the first match wins")
+	compareCommand.Flags().BoolVar(&compareOpt.all, "all", false, "print unchanged metrics too")
+}
+
+func compareResults(basePath, currentPath string) error {
+	thresholds := make([]report.Threshold, 0, len(compareOpt.thresholds))
+	for _, value := range compareOpt.thresholds {
+		threshold, err := report.ParseThreshold(value)
+		if err != nil {
+			return err
+		}
+		thresholds = append(thresholds, threshold)
+	}
+
+	base, err := report.ReadFile(basePath)
+	if err != nil {
+		return err
+	}
+	current, err := report.ReadFile(currentPath)
+	if err != nil {
+		return err
+	}
+	if base.Command != current.Command {
+		show.Warn("comparing a %s result with a %s result", base.Command, current.Command)
+	}
+
+	show.Info("Base: %s (%s, run %s)", basePath, base.StartedAt.Format(timeLayout), base.RunID)
+	show.Info("Current: %s (%s, run %s)", currentPath, current.StartedAt.Format(timeLayout), current.RunID)
+	show.EmptyLine()
+
+	regressions := 0
+	for _, delta := range report.Compare(base, current, thresholds) {
+		if delta.Change == 0 && !compareOpt.all && delta.Threshold == nil {
+			continue
+		}
+
+		line := fmt.Sprintf("%s: %s -> %s %s (%s)", delta.Name, formatValue(delta.Base), formatValue(delta.Current), delta.Unit, formatChange(delta.Change))
+		switch {
+		case delta.Regressed():
+			regressions++
+			show.Error("%s regressed beyond %.2f%%", line, delta.Threshold.Percent)
+		case delta.Regression() > 0:
+			show.Warn("%s worse", line)
+		case delta.Regression() < 0:
+			show.Info("%s better", line)
+		default:
+			show.Info("%s", line)
+		}
+	}
+
+	show.EmptyLine()
+	if regressions > 0 {
+		return fmt.Errorf("%d metrics regressed beyond their threshold", regressions)
+	}
+	show.Info("No metric regressed beyond its threshold")
+	return nil
+}
+
+func formatValue(value float64) string {
+	if value == math.Trunc(value) && math.Abs(value) < 1e15 {
+		return fmt.Sprintf("%.0f", value)
+	}
+	return fmt.Sprintf("%.3f", value)
+}
+
+func formatChange(change float64) string {
+	if math.IsInf(change, 0) {
+		return "new"
+	}
+	return fmt.Sprintf("%+.2f%%", change)
+}
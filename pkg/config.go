@@ -0,0 +1,235 @@
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds named profiles like staging or prod-shanghai
+type Config struct {
+	DefaultProfile string             `yaml:"default_profile"`
+	Profiles       map[string]Profile `yaml:"profiles"`
+}
+
+// Profile holds the connection settings as env vars and the workload and
+// output settings as flags. Flags and env vars that are already given win.
+type Profile struct {
+	Env   map[string]string                 `yaml:"env"`
+	Flags map[string]map[string]ConfigValue `yaml:"flags"` // command name, or all, to flag name to value
+}
+
+// ConfigValue is a flag value, a list sets a repeatable flag once per element
+type ConfigValue []string
+
+func (v *ConfigValue) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.SequenceNode {
+		var values []string
+		if err := node.Decode(&values); err != nil {
+			return err
+		}
+		*v = values
+		return nil
+	}
+	var value string
+	if err := node.Decode(&value); err != nil {
+		return err
+	}
+	*v = ConfigValue{value}
+	return nil
+}
+
+// allCommands is the flags section that applies to every command
+const allCommands = "all"
+
+// envFlags are the flags that default to an env var, the config does not set
+// them when the env var is given so env vars still win over the config
+var envFlags = map[string]string{
+	"protocol":      "CLICKHOUSE_PROTOCOL",
+	"results-table": "RESULTS_TABLE",
+}
+
+var (
+	configPath  string
+	profileName string
+	processEnv  map[string]bool // env vars given to the process, nil when not recorded
+)
+
+// RecordEnv remembers the env vars the process was started with. Call it
+// before loading .env, so the env of a profile wins over .env.
+func RecordEnv() {
+	processEnv = make(map[string]bool)
+	for _, entry := range os.Environ() {
+		processEnv[strings.SplitN(entry, "=", 2)[0]] = true
+	}
+}
+
+// envGiven reports whether the env var was given to the process
+func envGiven(key string) bool {
+	if processEnv == nil {
+		_, exists := os.LookupEnv(key)
+		return exists
+	}
+	return processEnv[key]
+}
+
+func init() {
+	root.PersistentFlags().StringVar(&configPath, "config", "", "YAML config file with named profiles, defaults to the CB_CONFIG env")
+	root.PersistentFlags().StringVar(&profileName, "profile", "", "profile of the config file, defaults to the CB_PROFILE env or the default_profile")
+	root.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		// Errors from here on are reported by Execute
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+		return applyConfig(cmd)
+	}
+}
+
+// loadConfig reads a YAML config, other formats like TOML are refused
+func loadConfig(path string) (*Config, error) {
+	if ext := strings.ToLower(filepath.Ext(path)); ext != ".yaml" && ext != ".yml" {
+		return nil, fmt.Errorf("config %s is not supported, use a .yaml or .yml file", path)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %v", err)
+	}
+	defer file.Close()
+
+	config := &Config{}
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(config); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %v", path, err)
+	}
+	return config, nil
+}
+
+// profile picks the profile from the flag, the env or the default of the config
+func (c *Config) profile(name string) (string, *Profile, error) {
+	if name == "" {
+		name = os.Getenv("CB_PROFILE")
+	}
+	if name == "" {
+		name = c.DefaultProfile
+	}
+	if name == "" {
+		return "", nil, fmt.Errorf("choose one of the profiles %s with --profile", strings.Join(c.names(), ", "))
+	}
+
+	profile, ok := c.Profiles[name]
+	if !ok {
+		return "", nil, fmt.Errorf("unknown profile %s, the config has %s", name, strings.Join(c.names(), ", "))
+	}
+	return name, &profile, nil
+}
+
+func (c *Config) names() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyConfig fills in the env vars and flags of the command that are not
+// given yet, so flags win over env vars and env vars win over the config
+func applyConfig(cmd *cobra.Command) error {
+	path := configPath
+	if path == "" {
+		path = os.Getenv("CB_CONFIG")
+	}
+	if path == "" {
+		if profileName != "" {
+			return fmt.Errorf("--profile requires a config file")
+		}
+		return nil
+	}
+
+	config, err := loadConfig(path)
+	if err != nil {
+		return err
+	}
+	name, profile, err := config.profile(profileName)
+	if err != nil {
+		return err
+	}
+
+	for key, value := range profile.Env {
+		if !envGiven(key) {
+			if err := os.Setenv(key, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	for command := range profile.Flags {
+		if command != allCommands && !isCommand(command) {
+			return fmt.Errorf("profile %s: unknown command %s", name, command)
+		}
+	}
+	// The section of the command goes before the all section
+	for _, command := range []string{cmd.Name(), allCommands} {
+		for flagName, values := range profile.Flags[command] {
+			if env, ok := envFlags[flagName]; ok && envGiven(env) {
+				continue
+			}
+			if err := setConfigFlag(cmd, command, flagName, values); err != nil {
+				return fmt.Errorf("profile %s: %v", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func setConfigFlag(cmd *cobra.Command, command, name string, values ConfigValue) error {
+	flag := cmd.Flags().Lookup(name)
+	if flag == nil {
+		// The all section may name flags that only some commands have
+		if command == allCommands {
+			return nil
+		}
+		return fmt.Errorf("unknown flag %s of %s", name, command)
+	}
+	if flag.Changed {
+		return nil
+	}
+	for _, value := range values {
+		if err := cmd.Flags().Set(name, value); err != nil {
+			return fmt.Errorf("invalid %s %q: %v", name, value, err)
+		}
+	}
+	return nil
+}
+
+func isCommand(name string) bool {
+	for _, command := range root.Commands() {
+		if command.Name() == name {
+			return true
+		}
+	}
+	return false
+}
@@ -19,31 +19,220 @@
 package pkg
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
 	"os"
 	"strings"
 	"time"
 
+	"clickhouse-benchmark/pkg/clickhouse"
+
 	ck "github.com/ClickHouse/clickhouse-go/v2"
 	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
 )
 
+// Protocols to talk to ClickHouse
+const (
+	nativeProtocol = "native"
+	httpProtocol   = "http"
+)
+
+var protocolFlag string
+
+func init() {
+	root.PersistentFlags().StringVar(&protocolFlag, "protocol", "", "native (TCP, port 9000) or http (port 8123), defaults to the CLICKHOUSE_PROTOCOL env or native")
+}
+
+// connProtocol returns the protocol from the flag or the env
+func connProtocol() (string, error) {
+	protocol := protocolFlag
+	if protocol == "" {
+		protocol = os.Getenv("CLICKHOUSE_PROTOCOL")
+	}
+	switch protocol {
+	case "", nativeProtocol:
+		return nativeProtocol, nil
+	case httpProtocol:
+		return httpProtocol, nil
+	}
+	return "", fmt.Errorf("invalid protocol: %s", protocol)
+}
+
 func getConn(addr string) (driver.Conn, error) {
+	protocol, err := connProtocol()
+	if err != nil {
+		return nil, err
+	}
+
 	options := &ck.Options{
 		Addr: strings.Split(addr, ","),
 		Auth: ck.Auth{
 			Username: os.Getenv("CLICKHOUSE_USER"),
 			Password: os.Getenv("CLICKHOUSE_PASSWORD"),
 		},
-		DialTimeout:     getDurationEnv("DIAL_TIME_OUT", 10*time.Second),
-		Debug:           getBoolEnv("DEBUG", false),
-		MaxIdleConns:    getIntEnv("MAX_IDLE_CONNS", 5),
-		MaxOpenConns:    getIntEnv("MAX_OPEN_CONNS", 10),
-		ConnMaxLifetime: getDurationEnv("CONN_MAX_LIFE_TIME", 1*time.Hour),
+	}
+	if err := configurePool(options); err != nil {
+		return nil, err
+	}
+	if err := configureConn(options, protocol); err != nil {
+		return nil, err
+	}
+	if protocol == httpProtocol {
+		return &taggedConn{clickhouse.OpenHTTP(options)}, nil
 	}
 
 	conn, err := ck.Open(options)
 	if err != nil {
 		return nil, err
 	}
-	return conn, nil
+	return &taggedConn{conn}, nil
+}
+
+// configurePool applies the timeout, debug and pool envs
+func configurePool(options *ck.Options) error {
+	var err error
+	if options.DialTimeout, err = getDurationEnv("DIAL_TIME_OUT", 10*time.Second); err != nil {
+		return err
+	}
+	if options.Debug, err = getBoolEnv("DEBUG", false); err != nil {
+		return err
+	}
+	if options.MaxIdleConns, err = getIntEnv("MAX_IDLE_CONNS", 5); err != nil {
+		return err
+	}
+	if options.MaxOpenConns, err = getIntEnv("MAX_OPEN_CONNS", 10); err != nil {
+		return err
+	}
+	if options.ConnMaxLifetime, err = getDurationEnv("CONN_MAX_LIFE_TIME", 1*time.Hour); err != nil {
+		return err
+	}
+	if options.DialTimeout <= 0 || options.MaxIdleConns < 0 || options.MaxOpenConns <= 0 || options.ConnMaxLifetime <= 0 {
+		return fmt.Errorf("DIAL_TIME_OUT, MAX_OPEN_CONNS and CONN_MAX_LIFE_TIME must be positive and MAX_IDLE_CONNS must not be negative")
+	}
+	return nil
+}
+
+// configureConn applies the TLS, compression, buffer, open strategy and settings envs
+func configureConn(options *ck.Options, protocol string) error {
+	tlsConfig, err := connTLS()
+	if err != nil {
+		return err
+	}
+	options.TLS = tlsConfig
+
+	compression, err := connCompression(protocol)
+	if err != nil {
+		return err
+	}
+	options.Compression = compression
+
+	blockBufferSize, err := getIntEnv("BLOCK_BUFFER_SIZE", 2)
+	if err != nil {
+		return err
+	}
+	if blockBufferSize < 1 || blockBufferSize > 255 {
+		return fmt.Errorf("BLOCK_BUFFER_SIZE must be between 1 and 255: %d", blockBufferSize)
+	}
+	options.BlockBufferSize = uint8(blockBufferSize)
+
+	switch strategy := os.Getenv("CONN_OPEN_STRATEGY"); strategy {
+	case "", "in_order":
+		options.ConnOpenStrategy = ck.ConnOpenInOrder
+	case "round_robin":
+		options.ConnOpenStrategy = ck.ConnOpenRoundRobin
+	default:
+		return fmt.Errorf("invalid CONN_OPEN_STRATEGY: %s", strategy)
+	}
+
+	settings, err := connSettings()
+	if err != nil {
+		return err
+	}
+	options.Settings = settings
+	return nil
+}
+
+// connTLS builds the TLS config, nil keeps the connection in plain text
+func connTLS() (*tls.Config, error) {
+	caFile := os.Getenv("CLICKHOUSE_TLS_CA_FILE")
+	certFile := os.Getenv("CLICKHOUSE_TLS_CERT_FILE")
+	keyFile := os.Getenv("CLICKHOUSE_TLS_KEY_FILE")
+	skipVerify, err := getBoolEnv("CLICKHOUSE_TLS_SKIP_VERIFY", false)
+	if err != nil {
+		return nil, err
+	}
+	enabled, err := getBoolEnv("CLICKHOUSE_TLS", false)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled && caFile == "" && certFile == "" && !skipVerify {
+		return nil, nil
+	}
+
+	config := &tls.Config{InsecureSkipVerify: skipVerify}
+	if caFile != "" {
+		ca, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the CA file: %v", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+	}
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, fmt.Errorf("CLICKHOUSE_TLS_CERT_FILE and CLICKHOUSE_TLS_KEY_FILE go together")
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// connCompression returns the compression method, the native protocol knows
+// lz4 and zstd and HTTP also gzip, deflate and br
+func connCompression(protocol string) (*ck.Compression, error) {
+	method := os.Getenv("CLICKHOUSE_COMPRESSION")
+	if method == "" {
+		return nil, nil
+	}
+
+	methods := map[string]ck.CompressionMethod{
+		"none": ck.CompressionNone,
+		"lz4":  ck.CompressionLZ4,
+		"zstd": ck.CompressionZSTD,
+	}
+	if protocol == httpProtocol {
+		methods["gzip"] = ck.CompressionGZIP
+		methods["deflate"] = ck.CompressionDeflate
+		methods["br"] = ck.CompressionBrotli
+	}
+	compression, ok := methods[method]
+	if !ok {
+		return nil, fmt.Errorf("invalid CLICKHOUSE_COMPRESSION %s for the %s protocol", method, protocol)
+	}
+	// The level only applies to gzip, deflate and br
+	level, err := getIntEnv("CLICKHOUSE_COMPRESSION_LEVEL", 3)
+	if err != nil {
+		return nil, err
+	}
+	return &ck.Compression{Method: compression, Level: level}, nil
+}
+
+// connSettings parses default server settings like max_threads=8,insert_quorum=2
+func connSettings() (ck.Settings, error) {
+	value := os.Getenv("CLICKHOUSE_SETTINGS")
+	if value == "" {
+		return ck.Settings{}, nil
+	}
+	settings, err := parseSettings(strings.Split(value, ","))
+	if err != nil {
+		return nil, fmt.Errorf("CLICKHOUSE_SETTINGS: %v", err)
+	}
+	return settings, nil
 }
@@ -22,18 +22,27 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strconv"
+	"time"
 
+	"clickhouse-benchmark/pkg/report"
 	"clickhouse-benchmark/pkg/show"
 
 	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
 	"github.com/spf13/cobra"
 )
 
+type descOption struct {
+	cluster string
+}
+
+var descOpt descOption
+
 var descCommand = &cobra.Command{
 	Use:  "desc",
 	Long: ` describe the table `,
 	Run: func(cmd *cobra.Command, args []string) {
-		if err := descClickhouse(); err != nil {
+		if err := descClickhouse(cmd); err != nil {
 			show.Error("Error: %v\n", err)
 			os.Exit(1)
 		}
@@ -42,15 +51,23 @@ var descCommand = &cobra.Command{
 
 func init() {
 	root.AddCommand(descCommand)
+	descCommand.Flags().StringVar(&descOpt.cluster, "cluster", "", "describe the table on every shard and replica of this cluster, defaults to the {cluster} macro")
+	addOutputFlags(descCommand)
 }
 
-func descClickhouse() error {
+func descClickhouse(cmd *cobra.Command) error {
+	if err := outputOpt.validate(); err != nil {
+		return err
+	}
+
 	conn, err := getConn(os.Getenv("CLICKHOUSE_URL"))
 	if err != nil {
 		return err
 	}
 	defer conn.Close()
 
+	document := newResult(cmd, conn, time.Now())
+
 	// Get create table SQL
 	createTableQuery, err := getCreateTableSQL(conn)
 	if err != nil {
@@ -78,7 +95,54 @@ func descClickhouse() error {
 
 	printPartitionAggregation(partitions)
 
-	return nil
+	storage, err := getTableStorage(conn)
+	if err != nil {
+		return err
+	}
+	storage.print()
+
+	// Local system.parts only covers the replica the driver picked
+	cluster, err := describeCluster(conn)
+	if err != nil {
+		show.Warn("failed to describe the cluster: %v", err)
+	}
+	if cluster != nil {
+		cluster.print()
+	}
+
+	addDescription(document, createTableQuery, partitions)
+	storage.addTo(document)
+	if cluster != nil {
+		cluster.addTo(document)
+	}
+	return publishResult(conn, document)
+}
+
+// addDescription adds the schema and the partitions to the result document
+func addDescription(document *report.Result, createTableQuery string, partitions []PartitionInfo) {
+	document.Tables = append(document.Tables, report.Table{
+		Name:    "schema",
+		Columns: []string{"database", "table", "create_table_query"},
+		Rows:    [][]string{{databaseName, tableName, createTableQuery}},
+	})
+
+	var rows, diskSize uint64
+	table := report.Table{Name: "partitions", Columns: []string{"partition", "disk", "rows", "bytes_on_disk"}}
+	for _, partition := range partitions {
+		rows += partition.RowCount
+		diskSize += partition.DiskSize
+		table.Rows = append(table.Rows, []string{
+			partition.Name,
+			partition.DiskName,
+			strconv.FormatUint(partition.RowCount, 10),
+			strconv.FormatUint(partition.DiskSize, 10),
+		})
+	}
+	document.Tables = append(document.Tables, table)
+
+	document.AddMetric("partitions", float64(len(partitions)), "partitions", false)
+	document.AddMetric("rows", float64(rows), "rows", true)
+	document.AddMetric("bytes_on_disk", float64(diskSize), "bytes", false)
 }
 
 type PartitionInfo struct {
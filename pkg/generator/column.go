@@ -0,0 +1,379 @@
+package generator
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"math/rand"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	nullRatio         = 0.1 // share of NULLs in Nullable columns
+	maxElements       = 4   // arrays and maps hold 0..maxElements elements
+	lowCardinality    = 100 // distinct values of LowCardinality and map key strings
+	maxArrayDepth     = 3
+	defaultStringSize = 12
+)
+
+var enumName = regexp.MustCompile(`'((?:[^'\\]|\\.)*)'\s*=`)
+
+// ColumnType is a parsed ClickHouse column type that draws values the driver
+// can append without reflecting over a struct
+type ColumnType struct {
+	Name     string        // base type like UInt64, Nullable or Array
+	Elements []*ColumnType // nested types of Nullable, LowCardinality, Array, Map and Tuple
+
+	length  int      // FixedString length
+	scale   int32    // Decimal scale
+	digits  int      // Decimal integer digits that fit an int64
+	values  []string // Enum names
+	lowCard bool     // inside LowCardinality, strings come from a small set
+	depth   int      // Array nesting depth
+}
+
+// ParseColumnType parses a type as found in system.columns
+func ParseColumnType(typ string) (*ColumnType, error) {
+	return parseColumnType(strings.TrimSpace(typ), false)
+}
+
+func parseColumnType(typ string, lowCard bool) (*ColumnType, error) {
+	name, params := typ, []string(nil)
+	if open := strings.IndexByte(typ, '('); open >= 0 {
+		if !strings.HasSuffix(typ, ")") {
+			return nil, fmt.Errorf("invalid type: %s", typ)
+		}
+		name = typ[:open]
+		params = splitParams(typ[open+1 : len(typ)-1])
+	}
+	t := &ColumnType{Name: name, lowCard: lowCard}
+
+	switch name {
+	case "Int8", "Int16", "Int32", "Int64", "Int128", "Int256",
+		"UInt8", "UInt16", "UInt32", "UInt64", "UInt128", "UInt256",
+		"Float32", "Float64", "Bool", "String", "UUID", "IPv4", "IPv6",
+		"Date", "Date32", "DateTime", "DateTime64":
+	case "FixedString":
+		if len(params) != 1 {
+			return nil, fmt.Errorf("invalid type: %s", typ)
+		}
+		length, err := strconv.Atoi(params[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid type: %s", typ)
+		}
+		t.length = length
+	case "Decimal", "Decimal32", "Decimal64", "Decimal128", "Decimal256":
+		if err := t.parseDecimal(params); err != nil {
+			return nil, fmt.Errorf("invalid type %s: %v", typ, err)
+		}
+	case "Enum8", "Enum16":
+		// Names stay escaped, the driver looks them up as written in the type
+		for _, match := range enumName.FindAllStringSubmatch(typ, -1) {
+			t.values = append(t.values, match[1])
+		}
+		if len(t.values) == 0 {
+			return nil, fmt.Errorf("enum without values: %s", typ)
+		}
+	case "Nullable", "LowCardinality", "Array":
+		if len(params) != 1 {
+			return nil, fmt.Errorf("invalid type: %s", typ)
+		}
+		element, err := parseColumnType(params[0], lowCard || name == "LowCardinality")
+		if err != nil {
+			return nil, err
+		}
+		t.Elements = []*ColumnType{element}
+		if name == "Array" {
+			t.depth = 1
+			if element.Name == "Array" {
+				t.depth += element.depth
+			}
+			if t.depth > maxArrayDepth {
+				return nil, fmt.Errorf("arrays nested deeper than %d are not supported: %s", maxArrayDepth, typ)
+			}
+		}
+	case "Map":
+		if len(params) != 2 {
+			return nil, fmt.Errorf("invalid type: %s", typ)
+		}
+		for i, param := range params {
+			element, err := parseColumnType(param, lowCard || i == 0)
+			if err != nil {
+				return nil, err
+			}
+			t.Elements = append(t.Elements, element)
+		}
+	case "Tuple":
+		for _, param := range params {
+			// Named tuples prefix every element with its name
+			if parts := splitParamsBy(param, ' '); len(parts) == 2 {
+				param = parts[1]
+			}
+			element, err := parseColumnType(param, lowCard)
+			if err != nil {
+				return nil, err
+			}
+			t.Elements = append(t.Elements, element)
+		}
+	case "SimpleAggregateFunction":
+		if len(params) != 2 {
+			return nil, fmt.Errorf("invalid type: %s", typ)
+		}
+		return parseColumnType(params[1], lowCard)
+	default:
+		return nil, fmt.Errorf("unsupported type: %s", typ)
+	}
+	return t, nil
+}
+
+func (t *ColumnType) parseDecimal(params []string) error {
+	precision, scale := 0, 0
+	var err error
+	switch t.Name {
+	case "Decimal":
+		if len(params) == 0 || len(params) > 2 {
+			return fmt.Errorf("expected precision and scale")
+		}
+		if precision, err = strconv.Atoi(params[0]); err != nil {
+			return err
+		}
+		if len(params) == 2 {
+			if scale, err = strconv.Atoi(params[1]); err != nil {
+				return err
+			}
+		}
+	default:
+		if len(params) != 1 {
+			return fmt.Errorf("expected scale")
+		}
+		if scale, err = strconv.Atoi(params[0]); err != nil {
+			return err
+		}
+		precision = map[string]int{"Decimal32": 9, "Decimal64": 18, "Decimal128": 38, "Decimal256": 76}[t.Name]
+	}
+	if scale < 0 || scale > precision {
+		return fmt.Errorf("invalid scale %d for precision %d", scale, precision)
+	}
+	t.scale = int32(scale)
+	t.digits = precision
+	if t.digits > 18 {
+		t.digits = 18
+	}
+	return nil
+}
+
+// splitParams splits type parameters on top level commas
+func splitParams(params string) []string {
+	return splitParamsBy(params, ',')
+}
+
+// splitParamsBy splits on separators outside of parentheses and quotes
+func splitParamsBy(params string, separator byte) []string {
+	var (
+		parts  []string
+		depth  int
+		quoted bool
+		start  int
+	)
+	for i := 0; i < len(params); i++ {
+		switch c := params[i]; {
+		case c == '\\' && quoted:
+			i++
+		case c == '\'':
+			quoted = !quoted
+		case quoted:
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == separator && depth == 0:
+			if part := strings.TrimSpace(params[start:i]); part != "" {
+				parts = append(parts, part)
+			}
+			start = i + 1
+		}
+	}
+	if part := strings.TrimSpace(params[start:]); part != "" {
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+// Value draws a value for the column and estimates its uncompressed size.
+// Date and time columns take the timestamp of the row.
+func (t *ColumnType) Value(r *rand.Rand, timestamp time.Time) (interface{}, int) {
+	switch t.Name {
+	case "Int8":
+		return int8(r.Uint32()), 1
+	case "Int16":
+		return int16(r.Uint32()), 2
+	case "Int32":
+		return int32(r.Uint32()), 4
+	case "Int64":
+		return int64(r.Uint64()), 8
+	case "UInt8":
+		return uint8(r.Uint32()), 1
+	case "UInt16":
+		return uint16(r.Uint32()), 2
+	case "UInt32":
+		return r.Uint32(), 4
+	case "UInt64":
+		return r.Uint64(), 8
+	case "Int128", "UInt128":
+		return big.NewInt(r.Int63()), 16
+	case "Int256", "UInt256":
+		return big.NewInt(r.Int63()), 32
+	case "Float32":
+		return float32(r.Float64() * 1000), 4
+	case "Float64":
+		return r.Float64() * 1000, 8
+	case "Bool":
+		return r.Intn(2) == 1, 1
+	case "String":
+		s := t.string(r)
+		return s, len(s)
+	case "FixedString":
+		return randomLetters(r, t.length), t.length
+	case "Decimal", "Decimal32", "Decimal64", "Decimal128", "Decimal256":
+		unscaled := r.Int63n(int64(math.Pow10(t.digits)))
+		return decimal.New(unscaled, -t.scale), 16
+	case "Enum8", "Enum16":
+		return t.values[r.Intn(len(t.values))], 2
+	case "UUID":
+		id, _ := uuid.NewRandomFromReader(r)
+		return id, 16
+	case "IPv4":
+		var ip [4]byte
+		r.Read(ip[:])
+		return netip.AddrFrom4(ip).String(), 4
+	case "IPv6":
+		var ip [16]byte
+		r.Read(ip[:])
+		return netip.AddrFrom16(ip).String(), 16
+	case "Date", "Date32", "DateTime", "DateTime64":
+		return timestamp, 8
+	case "Nullable":
+		if r.Float64() < nullRatio {
+			return nil, 1
+		}
+		value, size := t.Elements[0].Value(r, timestamp)
+		return value, size + 1
+	case "LowCardinality":
+		return t.Elements[0].Value(r, timestamp)
+	case "Array":
+		return t.array(r, timestamp)
+	case "Map":
+		return t.mapValue(r, timestamp)
+	case "Tuple":
+		values, total := make([]interface{}, len(t.Elements)), 0
+		for i, element := range t.Elements {
+			value, size := element.Value(r, timestamp)
+			values[i], total = value, total+size
+		}
+		return values, total
+	}
+	return nil, 0
+}
+
+func (t *ColumnType) string(r *rand.Rand) string {
+	if t.lowCard {
+		return Name("value_", r.Intn(lowCardinality), 0, 0)
+	}
+	return randomLetters(r, defaultStringSize)
+}
+
+// array builds a slice nested like the column, the driver walks nested arrays
+// by slice and only the innermost level may hold interface values
+func (t *ColumnType) array(r *rand.Rand, timestamp time.Time) (interface{}, int) {
+	leaf := t
+	for leaf.Name == "Array" {
+		leaf = leaf.Elements[0]
+	}
+	size := 0
+	elements := func() []interface{} {
+		values := make([]interface{}, r.Intn(maxElements+1))
+		for i := range values {
+			value, n := leaf.Value(r, timestamp)
+			values[i], size = value, size+n
+		}
+		size += 8
+		return values
+	}
+
+	switch t.depth {
+	case 1:
+		return elements(), size
+	case 2:
+		values := make([][]interface{}, r.Intn(maxElements+1))
+		for i := range values {
+			values[i] = elements()
+		}
+		return values, size + 8
+	default:
+		values := make([][][]interface{}, r.Intn(maxElements+1))
+		for i := range values {
+			values[i] = make([][]interface{}, r.Intn(maxElements+1))
+			for j := range values[i] {
+				values[i][j] = elements()
+			}
+		}
+		return values, size + 8
+	}
+}
+
+func (t *ColumnType) mapValue(r *rand.Rand, timestamp time.Time) (interface{}, int) {
+	m, size := &orderedMap{values: map[interface{}]interface{}{}}, 8
+	for i := r.Intn(maxElements + 1); i > 0; i-- {
+		key, keySize := t.Elements[0].Value(r, timestamp)
+		if _, ok := m.values[key]; ok {
+			continue
+		}
+		value, valueSize := t.Elements[1].Value(r, timestamp)
+		m.Put(key, value)
+		size += keySize + valueSize
+	}
+	return m, size
+}
+
+// orderedMap satisfies the ordered map interface of the driver so maps of any
+// key and value type can be appended
+type orderedMap struct {
+	keys   []interface{}
+	values map[interface{}]interface{}
+}
+
+func (m *orderedMap) Get(key interface{}) (interface{}, bool) {
+	value, ok := m.values[key]
+	return value, ok
+}
+
+func (m *orderedMap) Put(key interface{}, value interface{}) {
+	if _, ok := m.values[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = value
+}
+
+func (m *orderedMap) Keys() <-chan interface{} {
+	keys := make(chan interface{}, len(m.keys))
+	for _, key := range m.keys {
+		keys <- key
+	}
+	close(keys)
+	return keys
+}
+
+func randomLetters(r *rand.Rand, length int) string {
+	b := make([]byte, length)
+	for i := range b {
+		b[i] = letters[r.Intn(len(letters))]
+	}
+	return string(b)
+}
@@ -0,0 +1,247 @@
+package generator
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/column"
+	"github.com/shopspring/decimal"
+)
+
+// tree prints the parsed type with its nesting, so a test can compare the
+// whole parse in one string
+func tree(t *ColumnType) string {
+	if len(t.Elements) == 0 {
+		return t.Name
+	}
+	elements := make([]string, len(t.Elements))
+	for i, element := range t.Elements {
+		elements[i] = tree(element)
+	}
+	return t.Name + "(" + strings.Join(elements, ", ") + ")"
+}
+
+func TestParseColumnType(t *testing.T) {
+	tests := []struct {
+		typ  string
+		tree string
+	}{
+		{typ: "UInt64", tree: "UInt64"},
+		{typ: " String ", tree: "String"},
+		{typ: "DateTime64(3)", tree: "DateTime64"},
+		{typ: "DateTime64(3, 'UTC')", tree: "DateTime64"},
+		{typ: "DateTime64(9, 'Asia/Shanghai')", tree: "DateTime64"},
+		{typ: "DateTime('Europe/Amsterdam')", tree: "DateTime"},
+		{typ: "Nullable(Decimal(18, 4))", tree: "Nullable(Decimal)"},
+		{typ: "LowCardinality(String)", tree: "LowCardinality(String)"},
+		{typ: "LowCardinality(Nullable(String))", tree: "LowCardinality(Nullable(String))"},
+		{typ: "Array(Array(UInt8))", tree: "Array(Array(UInt8))"},
+		{typ: "Map(String, UInt64)", tree: "Map(String, UInt64)"},
+		{typ: "Map(String, Array(Nullable(Decimal(18, 4))))", tree: "Map(String, Array(Nullable(Decimal)))"},
+		{typ: "Map(LowCardinality(String), Map(String, DateTime64(3, 'UTC')))", tree: "Map(LowCardinality(String), Map(String, DateTime64))"},
+		{typ: "Tuple(UInt8, String)", tree: "Tuple(UInt8, String)"},
+		{typ: "Tuple(a UInt8, b Array(String))", tree: "Tuple(UInt8, Array(String))"},
+		{typ: "Tuple(ts DateTime64(3, 'UTC'), value Decimal(18, 4))", tree: "Tuple(DateTime64, Decimal)"},
+		{typ: "Array(Tuple(String, Map(String, Float64)))", tree: "Array(Tuple(String, Map(String, Float64)))"},
+		{typ: "Enum8('a, b' = 1, 'c(' = 2)", tree: "Enum8"},
+		{typ: "SimpleAggregateFunction(max, Decimal(18, 4))", tree: "Decimal"},
+	}
+
+	for _, test := range tests {
+		typ, err := ParseColumnType(test.typ)
+		if err != nil {
+			t.Errorf("ParseColumnType(%q): %v", test.typ, err)
+			continue
+		}
+		if got := tree(typ); got != test.tree {
+			t.Errorf("ParseColumnType(%q) = %s, want %s", test.typ, got, test.tree)
+		}
+	}
+}
+
+func TestParseColumnTypeParams(t *testing.T) {
+	typ, err := ParseColumnType("Map(String, Array(Nullable(Decimal(18, 4))))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decimal := typ.Elements[1].Elements[0].Elements[0]
+	if decimal.scale != 4 || decimal.digits != 18 {
+		t.Errorf("Decimal(18, 4) has scale %d and digits %d", decimal.scale, decimal.digits)
+	}
+	if !typ.Elements[0].lowCard || typ.Elements[1].lowCard {
+		t.Errorf("only the map keys should come from a small set")
+	}
+
+	typ, err = ParseColumnType("LowCardinality(Nullable(FixedString(16)))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixed := typ.Elements[0].Elements[0]
+	if fixed.length != 16 || !fixed.lowCard {
+		t.Errorf("FixedString(16) has length %d and lowCard %v", fixed.length, fixed.lowCard)
+	}
+
+	typ, err = ParseColumnType(`Enum8('a, b' = 1, 'it\'s' = 2, 'c(' = 3)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a, b", `it\'s`, "c("}; !reflect.DeepEqual(typ.values, want) {
+		t.Errorf("enum values = %q, want %q", typ.values, want)
+	}
+
+	typ, err = ParseColumnType("Array(Array(Array(UInt8)))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ.depth != 3 {
+		t.Errorf("depth = %d, want 3", typ.depth)
+	}
+}
+
+func TestParseColumnTypeErrors(t *testing.T) {
+	for _, typ := range []string{
+		"Geometry",
+		"Nullable(UInt8",
+		"Nullable(UInt8, String)",
+		"Map(String)",
+		"FixedString(n)",
+		"Decimal(4, 5)",
+		"Decimal32",
+		"Enum8()",
+		"Array(Array(Array(Array(UInt8))))",
+		"Tuple(UInt8, Unknown)",
+	} {
+		if _, err := ParseColumnType(typ); err == nil {
+			t.Errorf("ParseColumnType(%q) should fail", typ)
+		}
+	}
+}
+
+func TestSplitParamsBy(t *testing.T) {
+	tests := []struct {
+		params    string
+		separator byte
+		want      []string
+	}{
+		{params: "String, UInt64", separator: ',', want: []string{"String", "UInt64"}},
+		{params: "String, Array(Nullable(Decimal(18, 4)))", separator: ',', want: []string{"String", "Array(Nullable(Decimal(18, 4)))"}},
+		{params: "3, 'UTC'", separator: ',', want: []string{"3", "'UTC'"}},
+		{params: "'a, b' = 1, 'c(' = 2", separator: ',', want: []string{"'a, b' = 1", "'c(' = 2"}},
+		{params: `'it\'s, ok' = 1, 'd' = 2`, separator: ',', want: []string{`'it\'s, ok' = 1`, "'d' = 2"}},
+		{params: "ts DateTime64(3, 'UTC')", separator: ' ', want: []string{"ts", "DateTime64(3, 'UTC')"}},
+		{params: "", separator: ',', want: nil},
+	}
+
+	for _, test := range tests {
+		if got := splitParamsBy(test.params, test.separator); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("splitParamsBy(%q) = %q, want %q", test.params, got, test.want)
+		}
+	}
+}
+
+// TestColumnTypeValue appends the drawn values to the driver column of the
+// type, the driver refuses values that do not fit the column
+func TestColumnTypeValue(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	now := time.Now()
+	for _, typ := range []string{
+		"Int8", "Int64", "UInt32", "UInt128", "Int256", "Float32", "Float64", "Bool",
+		"String", "FixedString(16)", "UUID", "IPv4", "IPv6",
+		"Date", "Date32", "DateTime", "DateTime('UTC')", "DateTime64(3)", "DateTime64(3, 'UTC')",
+		"Decimal(18, 4)", "Decimal(9, 2)", "Decimal(38, 10)",
+		"Enum8('a' = 1, 'b c' = 2)", "Enum16('x' = 1000)",
+		"Nullable(Decimal(18, 4))",
+		"LowCardinality(String)", "LowCardinality(Nullable(String))",
+		"Array(UInt64)", "Array(Array(Nullable(String)))",
+		"Map(String, UInt64)", "Map(String, Array(Nullable(Decimal(18, 4))))",
+		"Map(LowCardinality(String), Map(String, DateTime64(3, 'UTC')))",
+		"Tuple(UInt8, String)", "Tuple(ts DateTime64(3, 'UTC'), value Decimal(18, 4))",
+		"Array(Tuple(String, Map(String, Float64)))",
+		"SimpleAggregateFunction(max, Decimal(18, 4))",
+	} {
+		columnType, err := ParseColumnType(typ)
+		if err != nil {
+			t.Fatalf("ParseColumnType(%q): %v", typ, err)
+		}
+		col, err := column.Type(typ).Column("c", time.UTC)
+		if err != nil {
+			t.Errorf("driver column %s: %v", typ, err)
+			continue
+		}
+		for i := 0; i < 100; i++ {
+			value, _ := columnType.Value(r, now)
+			if err := col.AppendRow(value); err != nil {
+				t.Errorf("%s: append %T %v: %v", typ, value, value, err)
+				break
+			}
+		}
+		if col.Rows() != 100 {
+			t.Errorf("%s: %d rows in the column, want 100", typ, col.Rows())
+		}
+	}
+}
+
+func TestColumnTypeValueTypes(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	now := time.Now()
+	draw := func(typ string) interface{} {
+		columnType, err := ParseColumnType(typ)
+		if err != nil {
+			t.Fatalf("ParseColumnType(%q): %v", typ, err)
+		}
+		value, _ := columnType.Value(r, now)
+		return value
+	}
+
+	if value, ok := draw("Decimal(18, 4)").(decimal.Decimal); !ok {
+		t.Errorf("Decimal value is %T, want decimal.Decimal", value)
+	} else if value.Exponent() != -4 {
+		t.Errorf("Decimal(18, 4) value has exponent %d, want -4", value.Exponent())
+	}
+
+	var null, set int
+	for i := 0; i < 1000; i++ {
+		switch value := draw("Nullable(UInt64)").(type) {
+		case nil:
+			null++
+		case uint64:
+			set++
+		default:
+			t.Fatalf("Nullable(UInt64) value is %T", value)
+		}
+	}
+	if null == 0 || set == 0 {
+		t.Errorf("Nullable(UInt64) drew %d NULLs and %d values", null, set)
+	}
+
+	if value, ok := draw("Tuple(ts DateTime64(3, 'UTC'), value Decimal(18, 4))").([]interface{}); !ok || len(value) != 2 {
+		t.Errorf("Tuple value is %T %v, want two elements", value, value)
+	} else {
+		if _, ok := value[0].(time.Time); !ok {
+			t.Errorf("Tuple element 0 is %T, want time.Time", value[0])
+		}
+		if _, ok := value[1].(decimal.Decimal); !ok {
+			t.Errorf("Tuple element 1 is %T, want decimal.Decimal", value[1])
+		}
+	}
+
+	for i := 0; i < 10; i++ {
+		value, ok := draw("Map(String, Nullable(Decimal(18, 4)))").(*orderedMap)
+		if !ok {
+			t.Fatalf("Map value is %T, want *orderedMap", value)
+		}
+		for key := range value.Keys() {
+			if _, ok := key.(string); !ok {
+				t.Errorf("Map key is %T, want string", key)
+			}
+			if element, _ := value.Get(key); element != nil {
+				if _, ok := element.(decimal.Decimal); !ok {
+					t.Errorf("Map value is %T, want decimal.Decimal or nil", element)
+				}
+			}
+		}
+	}
+}
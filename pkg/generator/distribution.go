@@ -0,0 +1,273 @@
+package generator
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Supported distributions
+const (
+	Uniform    = "uniform"
+	Zipf       = "zipf"
+	Normal     = "normal"
+	Sequential = "sequential"
+	Enum       = "enum"
+)
+
+const (
+	defaultZipfS     = 1.1
+	defaultZipfV     = 1
+	defaultMinLength = 8
+	defaultMaxLength = 16
+	letters          = "abcdefghijklmnopqrstuvwxyz0123456789"
+)
+
+// Distribution describes how the values of a column are drawn. Numbers come
+// straight from the distribution; strings are either one of Cardinality names
+// picked by the distribution, an enum value, or random strings when there is
+// no cardinality.
+type Distribution struct {
+	Type        string    `yaml:"distribution" json:"distribution"`
+	Min         float64   `yaml:"min" json:"min"`
+	Max         float64   `yaml:"max" json:"max"`
+	Mean        float64   `yaml:"mean" json:"mean"`
+	StdDev      float64   `yaml:"stddev" json:"stddev"`
+	S           float64   `yaml:"s" json:"s"` // zipf exponent, larger than 1
+	V           float64   `yaml:"v" json:"v"` // zipf offset, at least 1
+	Start       float64   `yaml:"start" json:"start"`
+	Step        float64   `yaml:"step" json:"step"`
+	Cardinality int       `yaml:"cardinality" json:"cardinality"`
+	Values      []string  `yaml:"values" json:"values"`
+	Weights     []float64 `yaml:"weights" json:"weights"`
+	Prefix      string    `yaml:"prefix" json:"prefix"`
+	MinLength   int       `yaml:"min_length" json:"min_length"`
+	MaxLength   int       `yaml:"max_length" json:"max_length"`
+
+	// sequence is shared by all samplers so sequential values do not repeat across workers
+	sequence *int64
+	numbers  []float64
+}
+
+// Constant returns a distribution that always yields the value
+func Constant(value string) Distribution {
+	return Distribution{Type: Enum, Values: []string{value}}
+}
+
+// Validate checks the parameters and fills in the defaults
+func (d *Distribution) Validate() error {
+	if d.Type == "" {
+		d.Type = Uniform
+	}
+	if d.Cardinality < 0 || d.MinLength < 0 || d.MaxLength < 0 {
+		return fmt.Errorf("%s: cardinality and lengths must not be negative", d.Type)
+	}
+	if d.MaxLength < d.MinLength {
+		d.MaxLength = d.MinLength
+	}
+
+	switch d.Type {
+	case Uniform:
+		if d.Max < d.Min {
+			return fmt.Errorf("uniform: max is smaller than min")
+		}
+	case Zipf:
+		if d.S == 0 {
+			d.S = defaultZipfS
+		}
+		if d.V == 0 {
+			d.V = defaultZipfV
+		}
+		if d.S <= 1 || d.V < 1 {
+			return fmt.Errorf("zipf: s must be larger than 1 and v at least 1")
+		}
+		if d.Cardinality == 0 && d.Max <= 0 {
+			return fmt.Errorf("zipf: cardinality or max is required")
+		}
+	case Normal:
+		if d.StdDev < 0 {
+			return fmt.Errorf("normal: stddev must not be negative")
+		}
+	case Sequential:
+		if d.Step == 0 {
+			d.Step = 1
+		}
+		d.sequence = new(int64)
+	case Enum:
+		if len(d.Values) == 0 {
+			return fmt.Errorf("enum: values are required")
+		}
+		if len(d.Weights) != 0 && len(d.Weights) != len(d.Values) {
+			return fmt.Errorf("enum: %d weights for %d values", len(d.Weights), len(d.Values))
+		}
+		for _, weight := range d.Weights {
+			if weight < 0 {
+				return fmt.Errorf("enum: weights must not be negative")
+			}
+		}
+	default:
+		return fmt.Errorf("invalid distribution: %q", d.Type)
+	}
+	return nil
+}
+
+// ValidateNumber validates a distribution that is sampled as numbers
+func (d *Distribution) ValidateNumber() error {
+	if err := d.Validate(); err != nil {
+		return err
+	}
+	if d.Type != Enum {
+		return nil
+	}
+
+	d.numbers = make([]float64, len(d.Values))
+	for i, value := range d.Values {
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("enum: %q is not a number", value)
+		}
+		d.numbers[i] = number
+	}
+	return nil
+}
+
+// Sampler draws values from a distribution, it is not safe for concurrent use
+type Sampler struct {
+	d    *Distribution
+	r    *rand.Rand
+	zipf *rand.Zipf
+}
+
+// NewSampler binds the validated distribution to a random source
+func (d *Distribution) NewSampler(r *rand.Rand) *Sampler {
+	s := &Sampler{d: d, r: r}
+	if d.Type == Zipf {
+		max := uint64(d.Max)
+		if d.Cardinality > 0 {
+			max = uint64(d.Cardinality - 1)
+		}
+		s.zipf = rand.NewZipf(r, d.S, d.V, max)
+	}
+	return s
+}
+
+// Float64 draws a number
+func (s *Sampler) Float64() float64 {
+	d := s.d
+	switch d.Type {
+	case Zipf:
+		return float64(s.zipf.Uint64())
+	case Normal:
+		return s.r.NormFloat64()*d.StdDev + d.Mean
+	case Sequential:
+		return d.Start + d.Step*float64(atomic.AddInt64(d.sequence, 1)-1)
+	case Enum:
+		return d.numbers[s.pick()]
+	default:
+		return d.Min + s.r.Float64()*(d.Max-d.Min)
+	}
+}
+
+// Int draws a number rounded to the nearest non negative integer, used for array lengths
+func (s *Sampler) Int() int {
+	value := math.Round(s.Float64())
+	if value < 0 {
+		return 0
+	}
+	return int(value)
+}
+
+// Index draws an index in [0, Cardinality)
+func (s *Sampler) Index() int {
+	d := s.d
+	cardinality := d.Cardinality
+	var index int
+	switch d.Type {
+	case Zipf:
+		index = int(s.zipf.Uint64())
+	case Normal:
+		index = int(math.Round(s.Float64()))
+	case Sequential:
+		index = int(atomic.AddInt64(d.sequence, 1) - 1)
+		return ((index % cardinality) + cardinality) % cardinality
+	default:
+		index = s.r.Intn(cardinality)
+	}
+
+	if index < 0 {
+		return 0
+	}
+	if index >= cardinality {
+		return cardinality - 1
+	}
+	return index
+}
+
+// String draws a string, prefix is used when the distribution has none
+func (s *Sampler) String(prefix string) string {
+	d := s.d
+	if d.Type == Enum {
+		return d.Values[s.pick()]
+	}
+	if d.Prefix != "" {
+		prefix = d.Prefix
+	}
+	if d.Cardinality == 0 {
+		return s.randomString()
+	}
+	return Name(prefix, s.Index(), d.MinLength, d.MaxLength)
+}
+
+// Name renders the index-th value of a bounded set. With lengths it is padded
+// so that the same index always gets the same length.
+func Name(prefix string, index, minLength, maxLength int) string {
+	name := prefix + strconv.Itoa(index)
+	length := minLength
+	if maxLength > minLength {
+		length += index % (maxLength - minLength + 1)
+	}
+	if len(name) < length {
+		name += strings.Repeat("x", length-len(name))
+	}
+	return name
+}
+
+func (s *Sampler) randomString() string {
+	minLength, maxLength := s.d.MinLength, s.d.MaxLength
+	if maxLength == 0 {
+		minLength, maxLength = defaultMinLength, defaultMaxLength
+	}
+
+	length := minLength
+	if maxLength > minLength {
+		length += s.r.Intn(maxLength - minLength + 1)
+	}
+	b := make([]byte, length)
+	for i := range b {
+		b[i] = letters[s.r.Intn(len(letters))]
+	}
+	return string(b)
+}
+
+func (s *Sampler) pick() int {
+	weights := s.d.Weights
+	if len(weights) == 0 {
+		return s.r.Intn(len(s.d.Values))
+	}
+
+	total := 0.0
+	for _, weight := range weights {
+		total += weight
+	}
+	target := s.r.Float64() * total
+	for i, weight := range weights {
+		target -= weight
+		if target < 0 {
+			return i
+		}
+	}
+	return len(weights) - 1
+}
@@ -65,7 +65,8 @@ func initClickhouse() error {
 
 	show.Info("Database and tables created successfully \n\n")
 
-	return nil
+	// Create the results table
+	return createResultsTable(conn)
 }
 
 func executeSQLFile(conn driver.Conn, filePath string) error {
@@ -0,0 +1,260 @@
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pkg
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"clickhouse-benchmark/pkg/show"
+)
+
+// behindRatio is the share of the requested rate below which an interval is reported as falling behind
+const behindRatio = 0.95
+
+// IntervalStat is the write throughput observed during one report interval
+type IntervalStat struct {
+	Start     time.Time
+	Elapsed   time.Duration
+	Rows      int64
+	Dropped   int64
+	Backlog   int
+	Requested float64 // rows per second, 0 means unlimited
+	Achieved  float64 // rows per second
+}
+
+// throughputRecorder counts written rows and turns them into per-interval stats
+type throughputRecorder struct {
+	requested func() float64
+	interval  time.Duration
+	backlog   func() int
+
+	rows    int64
+	dropped int64
+	total   int64
+
+	mu    sync.Mutex
+	start time.Time
+	stats []IntervalStat
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newThroughputRecorder(interval time.Duration, requested func() float64, backlog func() int) *throughputRecorder {
+	return &throughputRecorder{
+		requested: requested,
+		interval:  interval,
+		backlog:   backlog,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// Add records n rows that were written successfully
+func (r *throughputRecorder) Add(n int) {
+	atomic.AddInt64(&r.rows, int64(n))
+	atomic.AddInt64(&r.total, int64(n))
+}
+
+// Drop records n rows that were scheduled but never written
+func (r *throughputRecorder) Drop(n int) {
+	atomic.AddInt64(&r.dropped, int64(n))
+}
+
+// Total returns the number of rows written since the recorder was started
+func (r *throughputRecorder) Total() int64 {
+	return atomic.LoadInt64(&r.total)
+}
+
+// Start begins reporting the throughput every interval
+func (r *throughputRecorder) Start() {
+	r.start = time.Now()
+	go func() {
+		defer close(r.done)
+		if r.interval <= 0 {
+			<-r.stop
+			return
+		}
+
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.snapshot()
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends the reporting, records the last partial interval and returns all intervals
+func (r *throughputRecorder) Stop() []IntervalStat {
+	close(r.stop)
+	<-r.done
+	if r.interval > 0 && (atomic.LoadInt64(&r.rows) > 0 || atomic.LoadInt64(&r.dropped) > 0) {
+		r.snapshot()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stats
+}
+
+func (r *throughputRecorder) snapshot() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	stat := IntervalStat{
+		Start:     r.start,
+		Elapsed:   now.Sub(r.start),
+		Rows:      atomic.SwapInt64(&r.rows, 0),
+		Dropped:   atomic.SwapInt64(&r.dropped, 0),
+		Requested: r.requested(),
+	}
+	if r.backlog != nil {
+		stat.Backlog = r.backlog()
+	}
+	if stat.Elapsed > 0 {
+		stat.Achieved = float64(stat.Rows) / stat.Elapsed.Seconds()
+	}
+	r.stats = append(r.stats, stat)
+	r.start = now
+
+	show.Info("interval %d: rows: %d, requested: %.0f rows/s, achieved: %.0f rows/s, backlog: %d, dropped: %d",
+		len(r.stats), stat.Rows, stat.Requested, stat.Achieved, stat.Backlog, stat.Dropped)
+	if stat.Requested > 0 && stat.Achieved < stat.Requested*behindRatio {
+		show.Warn("interval %d is falling behind: achieved %.1f%% of the requested rate", len(r.stats), stat.Achieved/stat.Requested*100)
+	}
+}
+
+// QueryIntervalStat is the read throughput and latency observed during one report interval
+type QueryIntervalStat struct {
+	Start   time.Time
+	Elapsed time.Duration
+	Queries int // succeeded and failed
+	Failed  int
+	Rate    float64 // executed queries per second, failed included
+	Latency LatencySummary
+}
+
+// queryRecorder times the read queries and turns them into per-interval stats
+type queryRecorder struct {
+	interval time.Duration
+
+	mu      sync.Mutex
+	start   time.Time
+	failed  int
+	latency *latencyHistogram
+	stats   []QueryIntervalStat
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newQueryRecorder(interval time.Duration) *queryRecorder {
+	return &queryRecorder{
+		interval: interval,
+		latency:  newLatencyHistogram(),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Add records a query that succeeded after d
+func (r *queryRecorder) Add(d time.Duration) {
+	r.mu.Lock()
+	r.latency.Add(d)
+	r.mu.Unlock()
+}
+
+// Fail records a query that failed
+func (r *queryRecorder) Fail() {
+	r.mu.Lock()
+	r.failed++
+	r.mu.Unlock()
+}
+
+// Start begins reporting the queries every interval
+func (r *queryRecorder) Start() {
+	r.start = time.Now()
+	go func() {
+		defer close(r.done)
+		if r.interval <= 0 {
+			<-r.stop
+			return
+		}
+
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.snapshot()
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends the reporting, records the last partial interval and returns all intervals
+func (r *queryRecorder) Stop() []QueryIntervalStat {
+	close(r.stop)
+	<-r.done
+	r.mu.Lock()
+	pending := r.failed > 0 || r.latency.Summary().Count > 0
+	r.mu.Unlock()
+	if r.interval > 0 && pending {
+		r.snapshot()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stats
+}
+
+func (r *queryRecorder) snapshot() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	latency := r.latency
+	r.latency = newLatencyHistogram()
+	stat := QueryIntervalStat{
+		Start:   r.start,
+		Elapsed: now.Sub(r.start),
+		Failed:  r.failed,
+		Latency: latency.Summary(),
+	}
+	stat.Queries = stat.Latency.Count + stat.Failed
+	if stat.Elapsed > 0 {
+		stat.Rate = float64(stat.Queries) / stat.Elapsed.Seconds()
+	}
+	r.stats = append(r.stats, stat)
+	r.start = now
+	r.failed = 0
+
+	show.Info("read interval %d: queries: %d, failed: %d, %.1f executed queries/s, p50: %.2f ms, p99: %.2f ms",
+		len(r.stats), stat.Queries, stat.Failed, stat.Rate, stat.Latency.P50, stat.Latency.P99)
+}
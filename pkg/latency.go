@@ -0,0 +1,145 @@
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pkg
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"clickhouse-benchmark/pkg/report"
+	"clickhouse-benchmark/pkg/show"
+
+	"github.com/montanaflynn/stats"
+)
+
+// histogramBuckets is the number of exponential histogram buckets, the first one ends at 1ms
+const histogramBuckets = 18
+
+// LatencySummary holds the latency percentiles in milliseconds
+type LatencySummary struct {
+	Count int
+	Min   float64
+	Mean  float64
+	Max   float64
+	P50   float64
+	P80   float64
+	P99   float64
+	P999  float64
+}
+
+// HistogramBucket counts the latencies up to UpperBound milliseconds
+type HistogramBucket struct {
+	UpperBound float64
+	Count      int
+}
+
+// latencyHistogram collects latencies from concurrent workers
+type latencyHistogram struct {
+	sync.Mutex
+	samples []float64 // milliseconds
+}
+
+func newLatencyHistogram() *latencyHistogram {
+	return &latencyHistogram{}
+}
+
+func (h *latencyHistogram) Add(d time.Duration) {
+	h.Lock()
+	h.samples = append(h.samples, float64(d)/float64(time.Millisecond))
+	h.Unlock()
+}
+
+func (h *latencyHistogram) Summary() LatencySummary {
+	h.Lock()
+	defer h.Unlock()
+
+	summary := LatencySummary{Count: len(h.samples)}
+	if len(h.samples) == 0 {
+		return summary
+	}
+
+	data := stats.Float64Data(h.samples)
+	summary.Min, _ = data.Min()
+	summary.Mean, _ = data.Mean()
+	summary.Max, _ = data.Max()
+	summary.P50, _ = data.Percentile(50)
+	summary.P80, _ = data.Percentile(80)
+	summary.P99, _ = data.Percentile(99)
+	summary.P999, _ = data.Percentile(99.9)
+	return summary
+}
+
+// Buckets returns the exponential histogram, each bucket doubles the upper bound of the previous one
+func (h *latencyHistogram) Buckets() []HistogramBucket {
+	h.Lock()
+	defer h.Unlock()
+
+	buckets := make([]HistogramBucket, histogramBuckets)
+	for i := range buckets {
+		buckets[i].UpperBound = math.Pow(2, float64(i))
+	}
+	buckets[len(buckets)-1].UpperBound = math.Inf(1)
+
+	for _, sample := range h.samples {
+		for i := range buckets {
+			if sample <= buckets[i].UpperBound {
+				buckets[i].Count++
+				break
+			}
+		}
+	}
+	return buckets
+}
+
+func (h *latencyHistogram) Print(title string) {
+	summary := h.Summary()
+	show.Info("%s latency (ms) min: %.2f, mean: %.2f, max: %.2f", title, summary.Min, summary.Mean, summary.Max)
+	show.Info("%s latency (ms) p50: %.2f, p80: %.2f, p99: %.2f, p999: %.2f", title, summary.P50, summary.P80, summary.P99, summary.P999)
+	if summary.Count == 0 {
+		return
+	}
+
+	buckets := h.Buckets()
+	// Skip the empty buckets on both ends
+	first, last := 0, len(buckets)-1
+	for first < last && buckets[first].Count == 0 {
+		first++
+	}
+	for last > first && buckets[last].Count == 0 {
+		last--
+	}
+
+	for _, bucket := range buckets[first : last+1] {
+		bar := strings.Repeat("#", int(math.Ceil(float64(bucket.Count)/float64(summary.Count)*50)))
+		show.Info("<= %8.0f ms: %6d %s", bucket.UpperBound, bucket.Count, bar)
+	}
+}
+
+// addMetrics adds the summary to the result as metrics named like insert_latency_p50
+func (s LatencySummary) addMetrics(result *report.Result, prefix string) {
+	result.AddMetric(prefix+"_latency_min", s.Min, "ms", false)
+	result.AddMetric(prefix+"_latency_mean", s.Mean, "ms", false)
+	result.AddMetric(prefix+"_latency_max", s.Max, "ms", false)
+	result.AddMetric(prefix+"_latency_p50", s.P50, "ms", false)
+	result.AddMetric(prefix+"_latency_p80", s.P80, "ms", false)
+	result.AddMetric(prefix+"_latency_p99", s.P99, "ms", false)
+	result.AddMetric(prefix+"_latency_p999", s.P999, "ms", false)
+}
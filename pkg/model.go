@@ -66,3 +66,31 @@ func generateMetric(timestamp time.Time, randomColumn bool) Metric {
 
 	return metric
 }
+
+// RowValues returns the values in the order of metricColumnNames, inserts over HTTP need them
+func (m *Metric) RowValues() []interface{} {
+	return []interface{}{
+		m.Timestamp, m.MetricGroup,
+		m.NumberFieldKeys, m.NumberFieldValues,
+		m.StringFieldKeys, m.StringFieldValues,
+		m.TagKeys, m.TagValues,
+	}
+}
+
+// Size returns the approximate uncompressed size of the metric in the native format
+func (m *Metric) Size() int {
+	// timestamp, metric group and one offset per array
+	size := 8 + len(m.MetricGroup) + 1 + 6*8
+	size += stringsSize(m.NumberFieldKeys) + 8*len(m.NumberFieldValues)
+	size += stringsSize(m.StringFieldKeys) + stringsSize(m.StringFieldValues)
+	size += stringsSize(m.TagKeys) + stringsSize(m.TagValues)
+	return size
+}
+
+func stringsSize(values []string) int {
+	size := 0
+	for _, value := range values {
+		size += len(value) + 1
+	}
+	return size
+}
@@ -0,0 +1,107 @@
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"clickhouse-benchmark/pkg/report"
+	"clickhouse-benchmark/pkg/show"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+type outputOption struct {
+	path   string
+	format string
+}
+
+var outputOpt outputOption
+
+func addOutputFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&outputOpt.path, "output", "o", "", "write the result document to this file, - for stdout")
+	cmd.Flags().StringVar(&outputOpt.format, "format", "", "json, csv or markdown, guessed from the output extension by default")
+}
+
+func (o *outputOption) validate() error {
+	if _, _, err := resultsTarget(); err != nil {
+		return err
+	}
+	if o.path == "" {
+		return nil
+	}
+	if o.format == "" {
+		o.format = report.FormatFromPath(o.path)
+	}
+	switch o.format {
+	case report.FormatJSON, report.FormatCSV, report.FormatMarkdown:
+	default:
+		return fmt.Errorf("invalid output format: %s", o.format)
+	}
+
+	// Keep stdout clean for the result document
+	if o.path == "-" {
+		show.SetOutput(os.Stderr)
+	}
+	return nil
+}
+
+// newResult starts the result document of the command with its flags as the run parameters
+func newResult(cmd *cobra.Command, conn driver.Conn, startedAt time.Time) *report.Result {
+	result := report.New(cmd.Name(), startedAt)
+	result.RunID = runID
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		if flag.Name != "help" {
+			result.Parameters[flag.Name] = flag.Value.String()
+		}
+	})
+	if protocol, err := connProtocol(); err == nil {
+		result.Parameters["protocol"] = protocol
+	}
+	// Connection envs that change the results, like the compression method
+	for name, env := range map[string]string{"compression": "CLICKHOUSE_COMPRESSION", "settings": "CLICKHOUSE_SETTINGS"} {
+		if value := os.Getenv(env); value != "" {
+			result.Parameters[name] = value
+		}
+	}
+	if version, err := conn.ServerVersion(); err == nil {
+		result.Environment.ServerVersion = version.String()
+	}
+	return result
+}
+
+// publishResult writes the result document when --output is given and
+// stores it in the results table when one is configured
+func publishResult(conn driver.Conn, result *report.Result) error {
+	result.Elapsed = time.Since(result.StartedAt).Seconds()
+	if outputOpt.path != "" {
+		if err := report.WriteFile(result, outputOpt.path, outputOpt.format); err != nil {
+			return fmt.Errorf("failed to write the result: %v", err)
+		}
+		if outputOpt.path != "-" {
+			show.Info("Result written to %s", outputOpt.path)
+		}
+	}
+
+	return persistResult(conn, result)
+}
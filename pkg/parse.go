@@ -19,49 +19,52 @@
 package pkg
 
 import (
+	"fmt"
 	"os"
 	"strconv"
 	"time"
 )
 
-func getBoolEnv(key string, defaultValue bool) bool {
+// The getters return the default when the env is not set, and an error when it does not parse
+
+func getBoolEnv(key string, defaultValue bool) (bool, error) {
 	value, exists := os.LookupEnv(key)
 	if !exists {
-		return defaultValue
+		return defaultValue, nil
 	}
 
 	boolValue, err := strconv.ParseBool(value)
 	if err != nil {
-		return defaultValue
+		return defaultValue, fmt.Errorf("invalid %s %q: expected true or false", key, value)
 	}
 
-	return boolValue
+	return boolValue, nil
 }
 
-func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
+func getDurationEnv(key string, defaultValue time.Duration) (time.Duration, error) {
 	value, exists := os.LookupEnv(key)
 	if !exists {
-		return defaultValue
+		return defaultValue, nil
 	}
 
 	durationValue, err := time.ParseDuration(value)
 	if err != nil {
-		return defaultValue
+		return defaultValue, fmt.Errorf("invalid %s %q: expected a duration like 10s", key, value)
 	}
 
-	return durationValue
+	return durationValue, nil
 }
 
-func getIntEnv(key string, defaultValue int) int {
+func getIntEnv(key string, defaultValue int) (int, error) {
 	value, exists := os.LookupEnv(key)
 	if !exists {
-		return defaultValue
+		return defaultValue, nil
 	}
 
 	intValue, err := strconv.Atoi(value)
 	if err != nil {
-		return defaultValue
+		return defaultValue, fmt.Errorf("invalid %s %q: expected an integer", key, value)
 	}
 
-	return intValue
+	return intValue, nil
 }
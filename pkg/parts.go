@@ -0,0 +1,294 @@
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"clickhouse-benchmark/pkg/report"
+	"clickhouse-benchmark/pkg/show"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+// partsWarnRatio of a parts threshold starts the warnings
+const partsWarnRatio = 0.8
+
+var partsSetting = regexp.MustCompile(`\b(parts_to_delay_insert|parts_to_throw_insert)\s*=\s*(\d+)`)
+
+// partsSample is the part and merge state of the target table at one point
+type partsSample struct {
+	time              time.Time
+	activeParts       uint64
+	partitions        uint64
+	partitionParts    uint64 // active parts of the fullest partition, the thresholds apply to it
+	merges            uint64
+	mergeBacklogBytes uint64 // compressed bytes the running merges still have to process
+}
+
+// partsTracker follows the parts of the target table during a write, since
+// too many parts in a partition delay and finally reject inserts
+type partsTracker struct {
+	conn      driver.Conn
+	database  string
+	table     string
+	interval  time.Duration
+	clock     time.Time
+	delayAt   uint64 // parts_to_delay_insert
+	throwAt   uint64 // parts_to_throw_insert
+	newParts  uint64 // from system.part_log, once the run is over
+	merges    uint64
+	merged    uint64 // parts merged away by them
+	partLogOK bool
+
+	mu      sync.Mutex
+	samples []partsSample
+	failed  int
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// startPartsTracker starts polling when the interval is positive
+func startPartsTracker(conn driver.Conn, opt *WriteOption, clock time.Time) *partsTracker {
+	if opt.partsInterval <= 0 || debugFlag {
+		return nil
+	}
+	database, table := opt.insertTable()
+	t := &partsTracker{
+		conn:     conn,
+		database: database,
+		table:    table,
+		interval: opt.partsInterval,
+		clock:    clock,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if err := t.loadThresholds(); err != nil {
+		show.Warn("failed to read the parts thresholds of %s.%s: %v", database, table, err)
+	}
+	show.Info("Tracking parts of %s.%s every %v, parts_to_delay_insert: %d, parts_to_throw_insert: %d", database, table, t.interval, t.delayAt, t.throwAt)
+
+	go func() {
+		defer close(t.done)
+		t.sample()
+
+		ticker := time.NewTicker(t.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				t.sample()
+			case <-t.stop:
+				return
+			}
+		}
+	}()
+	return t
+}
+
+// loadThresholds reads the server defaults, the SETTINGS of the table override them
+func (t *partsTracker) loadThresholds() error {
+	ctx := context.Background()
+	rows, err := t.conn.Query(ctx, "SELECT name, value FROM system.merge_tree_settings WHERE name IN ('parts_to_delay_insert', 'parts_to_throw_insert')")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	settings := make(map[string]string)
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			return err
+		}
+		settings[name] = value
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	var engine string
+	query := fmt.Sprintf("SELECT engine_full FROM system.tables WHERE database = '%s' AND name = '%s'", t.database, t.table)
+	if err := t.conn.QueryRow(ctx, query).Scan(&engine); err != nil {
+		return err
+	}
+	for _, match := range partsSetting.FindAllStringSubmatch(engine, -1) {
+		settings[match[1]] = match[2]
+	}
+
+	t.delayAt, _ = strconv.ParseUint(settings["parts_to_delay_insert"], 10, 64)
+	t.throwAt, _ = strconv.ParseUint(settings["parts_to_throw_insert"], 10, 64)
+	return nil
+}
+
+// Stop ends the polling and counts the new and merged parts of the run in system.part_log
+func (t *partsTracker) Stop() {
+	if t == nil {
+		return
+	}
+	close(t.stop)
+	<-t.done
+	t.sample()
+
+	if err := t.loadPartLog(); err != nil {
+		show.Warn("failed to read system.part_log: %v", err)
+	}
+}
+
+func (t *partsTracker) sample() {
+	sample, err := t.poll()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err != nil {
+		t.failed++
+		if t.failed == 1 {
+			show.Warn("failed to sample the parts of %s.%s: %v", t.database, t.table, err)
+		}
+		return
+	}
+	t.samples = append(t.samples, sample)
+
+	switch parts := sample.partitionParts; {
+	case t.throwAt > 0 && float64(parts) >= float64(t.throwAt)*partsWarnRatio:
+		show.Warn("%d active parts in one partition, inserts fail at parts_to_throw_insert %d", parts, t.throwAt)
+	case t.delayAt > 0 && parts >= t.delayAt:
+		show.Warn("%d active parts in one partition, inserts are delayed from parts_to_delay_insert %d", parts, t.delayAt)
+	case t.delayAt > 0 && float64(parts) >= float64(t.delayAt)*partsWarnRatio:
+		show.Warn("%d active parts in one partition, inserts get delayed at parts_to_delay_insert %d", parts, t.delayAt)
+	}
+}
+
+func (t *partsTracker) poll() (partsSample, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), t.interval)
+	defer cancel()
+
+	sample := partsSample{time: time.Now()}
+	query := fmt.Sprintf(`SELECT toUInt64(sum(parts)), toUInt64(count()), toUInt64(max(parts))
+		FROM (SELECT partition_id, count() AS parts FROM system.parts WHERE active AND database = '%s' AND table = '%s' GROUP BY partition_id)`, t.database, t.table)
+	if err := t.conn.QueryRow(ctx, query).Scan(&sample.activeParts, &sample.partitions, &sample.partitionParts); err != nil {
+		return sample, err
+	}
+
+	query = fmt.Sprintf(`SELECT toUInt64(count()), toUInt64(sum(total_size_bytes_compressed * (1 - progress)))
+		FROM system.merges WHERE database = '%s' AND table = '%s'`, t.database, t.table)
+	if err := t.conn.QueryRow(ctx, query).Scan(&sample.merges, &sample.mergeBacklogBytes); err != nil {
+		return sample, err
+	}
+	return sample, nil
+}
+
+func (t *partsTracker) loadPartLog() error {
+	ctx := context.Background()
+	if err := t.conn.Exec(ctx, "SYSTEM FLUSH LOGS"); err != nil {
+		return err
+	}
+	query := fmt.Sprintf(`SELECT toUInt64(countIf(event_type = 'NewPart')), toUInt64(countIf(event_type = 'MergeParts')),
+			toUInt64(sumIf(length(merged_from), event_type = 'MergeParts'))
+		FROM system.part_log WHERE event_time >= toDateTime(%d) AND database = '%s' AND table = '%s'`, t.clock.Unix(), t.database, t.table)
+	if err := t.conn.QueryRow(ctx, query).Scan(&t.newParts, &t.merges, &t.merged); err != nil {
+		return err
+	}
+	t.partLogOK = true
+	return nil
+}
+
+// peak is the largest of each value over the samples
+func (t *partsTracker) peak() partsSample {
+	var peak partsSample
+	for _, sample := range t.samples {
+		peak.activeParts = maxUint64(peak.activeParts, sample.activeParts)
+		peak.partitions = maxUint64(peak.partitions, sample.partitions)
+		peak.partitionParts = maxUint64(peak.partitionParts, sample.partitionParts)
+		peak.merges = maxUint64(peak.merges, sample.merges)
+		peak.mergeBacklogBytes = maxUint64(peak.mergeBacklogBytes, sample.mergeBacklogBytes)
+	}
+	return peak
+}
+
+func maxUint64(a, b uint64) uint64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func (t *partsTracker) print() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.samples) == 0 {
+		return
+	}
+
+	peak := t.peak()
+	show.EmptyLine()
+	show.Info("Parts of %s.%s: %d samples every %v", t.database, t.table, len(t.samples), t.interval)
+	show.Info("Peak active parts: %d, partitions: %d, parts in one partition: %d (delay at %d, throw at %d)",
+		peak.activeParts, peak.partitions, peak.partitionParts, t.delayAt, t.throwAt)
+	show.Info("Peak merges: %d, merge backlog: %.2f MB", peak.merges, float64(peak.mergeBacklogBytes)/1024/1024)
+	if t.partLogOK {
+		show.Info("New parts: %d, merges: %d, parts merged away: %d", t.newParts, t.merges, t.merged)
+	}
+}
+
+// addTo adds the peaks as metrics and the samples as the parts series
+func (t *partsTracker) addTo(result *report.Result) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.samples) == 0 {
+		return
+	}
+
+	peak := t.peak()
+	result.AddMetric("peak_active_parts", float64(peak.activeParts), "parts", false)
+	result.AddMetric("peak_partitions", float64(peak.partitions), "partitions", false)
+	result.AddMetric("peak_parts_per_partition", float64(peak.partitionParts), "parts", false)
+	result.AddMetric("peak_merges", float64(peak.merges), "merges", false)
+	result.AddMetric("peak_merge_backlog_bytes", float64(peak.mergeBacklogBytes), "bytes", false)
+	if t.partLogOK {
+		result.AddMetric("new_parts", float64(t.newParts), "parts", false)
+		result.AddMetric("merges", float64(t.merges), "merges", false)
+		result.AddMetric("merged_parts", float64(t.merged), "parts", false)
+	}
+
+	series := report.Series{
+		Name:   "parts",
+		Fields: []string{"active_parts", "partitions", "max_parts_per_partition", "merges", "merge_backlog_bytes"},
+	}
+	for _, sample := range t.samples {
+		series.Points = append(series.Points, report.Point{
+			Time:   sample.time,
+			Offset: sample.time.Sub(t.clock).Seconds(),
+			Values: []float64{float64(sample.activeParts), float64(sample.partitions), float64(sample.partitionParts), float64(sample.merges), float64(sample.mergeBacklogBytes)},
+		})
+	}
+	result.Series = append(result.Series, series)
+}
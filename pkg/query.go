@@ -0,0 +1,142 @@
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	ck "github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+)
+
+var queryIDPrefix string
+
+func init() {
+	root.PersistentFlags().StringVar(&queryIDPrefix, "query-id-prefix", "cb", "prefix of the query_id of every query, followed by the run ID, the query kind and a sequence number")
+}
+
+// runID identifies the run in the result document and in the query_id of its queries
+var runID = uuid.New().String()
+
+var querySequence int64
+
+type queryIDKey struct{}
+
+// runQueryIDPrefix starts the query_id of every query of the run
+func runQueryIDPrefix() string {
+	return queryIDPrefix + "-" + runID + "-"
+}
+
+// withQueryID tags the query so system.query_log can be searched for the run,
+// the id looks like cb-<run id>-read.top_groups-42
+func withQueryID(ctx context.Context, kind string) context.Context {
+	id := fmt.Sprintf("%s%s-%d", runQueryIDPrefix(), kind, atomic.AddInt64(&querySequence, 1))
+	return context.WithValue(ck.Context(ctx, ck.WithQueryID(id)), queryIDKey{}, id)
+}
+
+// taggedConn gives every query that has no query_id yet one of the run
+type taggedConn struct {
+	driver.Conn
+}
+
+func (c *taggedConn) tag(ctx context.Context, kind string) context.Context {
+	if ctx.Value(queryIDKey{}) != nil {
+		return ctx
+	}
+	return withQueryID(ctx, kind)
+}
+
+func (c *taggedConn) Select(ctx context.Context, dest any, query string, args ...any) error {
+	return c.Conn.Select(c.tag(ctx, "query"), dest, query, args...)
+}
+
+func (c *taggedConn) Query(ctx context.Context, query string, args ...any) (driver.Rows, error) {
+	return c.Conn.Query(c.tag(ctx, "query"), query, args...)
+}
+
+func (c *taggedConn) QueryRow(ctx context.Context, query string, args ...any) driver.Row {
+	return c.Conn.QueryRow(c.tag(ctx, "query"), query, args...)
+}
+
+func (c *taggedConn) PrepareBatch(ctx context.Context, query string) (driver.Batch, error) {
+	return c.Conn.PrepareBatch(c.tag(ctx, "insert"), query)
+}
+
+func (c *taggedConn) Exec(ctx context.Context, query string, args ...any) error {
+	return c.Conn.Exec(c.tag(ctx, "exec"), query, args...)
+}
+
+func (c *taggedConn) AsyncInsert(ctx context.Context, query string, wait bool) error {
+	return c.Conn.AsyncInsert(c.tag(ctx, "insert"), query, wait)
+}
+
+// addSettingsFlag registers the repeatable --setting flag of a command
+func addSettingsFlag(cmd *cobra.Command, settings *[]string) {
+	cmd.Flags().StringArrayVar(settings, "setting", nil, "ClickHouse setting like max_threads=8 for the queries of the command, repeatable")
+}
+
+// parseSettings parses name=value pairs
+func parseSettings(pairs []string) (ck.Settings, error) {
+	settings := ck.Settings{}
+	for _, pair := range pairs {
+		name, value, ok := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid setting %q, expected name=value", pair)
+		}
+		settings[name] = strings.TrimSpace(value)
+	}
+	return settings, nil
+}
+
+// settingsOf converts the settings of a workload or scenario file
+func settingsOf(values map[string]string) ck.Settings {
+	settings := ck.Settings{}
+	for name, value := range values {
+		settings[name] = value
+	}
+	return settings
+}
+
+// mergeSettings returns a new map, the later settings win
+func mergeSettings(all ...ck.Settings) ck.Settings {
+	merged := ck.Settings{}
+	for _, settings := range all {
+		for name, value := range settings {
+			merged[name] = value
+		}
+	}
+	return merged
+}
+
+// formatSettings renders settings sorted by name for the report
+func formatSettings(settings ck.Settings) string {
+	pairs := make([]string, 0, len(settings))
+	for name, value := range settings {
+		pairs = append(pairs, fmt.Sprintf("%s=%v", name, value))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ", ")
+}
@@ -0,0 +1,252 @@
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"clickhouse-benchmark/pkg/report"
+	"clickhouse-benchmark/pkg/show"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/spf13/cobra"
+)
+
+type queryLogOption struct {
+	enabled bool
+}
+
+var queryLogOpt queryLogOption
+
+func addQueryLogFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&queryLogOpt.enabled, "query-log", true, "compare the client latency of every query with its server stats from system.query_log after the run")
+}
+
+// clientQueries holds the client latency of the tagged queries by query_id
+var clientQueries = struct {
+	sync.Mutex
+	latencies map[string]time.Duration
+}{latencies: make(map[string]time.Duration)}
+
+// recordQuery remembers the client latency of the query tagged in ctx
+func recordQuery(ctx context.Context, latency time.Duration) {
+	id, ok := ctx.Value(queryIDKey{}).(string)
+	if !ok || !queryLogOpt.enabled {
+		return
+	}
+	clientQueries.Lock()
+	clientQueries.latencies[id] = latency
+	clientQueries.Unlock()
+}
+
+// serverQueryStat sums up the queries of one kind like insert or read.top_groups
+type serverQueryStat struct {
+	kind         string
+	queries      int
+	failed       int // finished with an exception on the server
+	client       *latencyHistogram
+	server       *latencyHistogram // query_duration_ms
+	overhead     *latencyHistogram // client minus server, the network and the driver
+	readRows     uint64
+	readBytes    uint64
+	writtenRows  uint64
+	writtenBytes uint64
+	memoryPeak   uint64
+	memoryTotal  uint64
+	cpu          time.Duration // OSCPUVirtualTimeMicroseconds
+}
+
+// serverStats is what system.query_log knows about the queries of the run
+type serverStats struct {
+	expected int // queries with a client latency
+	found    int
+	kinds    []*serverQueryStat
+}
+
+// captureServerStats flushes the logs, matches the query_log entries of the
+// run with the client latencies and adds them to the report
+func captureServerStats(conn driver.Conn, document *report.Result) {
+	clientQueries.Lock()
+	latencies := clientQueries.latencies
+	clientQueries.latencies = make(map[string]time.Duration)
+	clientQueries.Unlock()
+	if !queryLogOpt.enabled || debugFlag || len(latencies) == 0 {
+		return
+	}
+
+	stats, err := collectServerStats(conn, document.StartedAt, latencies)
+	if err != nil {
+		show.Warn("failed to read system.query_log: %v", err)
+		return
+	}
+	stats.print()
+	stats.addTo(document)
+}
+
+func collectServerStats(conn driver.Conn, since time.Time, latencies map[string]time.Duration) (*serverStats, error) {
+	ctx := context.Background()
+	if err := conn.Exec(ctx, "SYSTEM FLUSH LOGS"); err != nil {
+		return nil, fmt.Errorf("failed to flush the logs: %v", err)
+	}
+
+	query := `SELECT query_id, toUInt8(type = 'QueryFinish'), query_duration_ms, read_rows, read_bytes,
+			written_rows, written_bytes, toUInt64(greatest(memory_usage, 0)), ProfileEvents['OSCPUVirtualTimeMicroseconds']
+		FROM system.query_log
+		WHERE event_date >= toDate(toDateTime(?)) AND event_time >= toDateTime(?)
+			AND startsWith(query_id, ?) AND type != 'QueryStart'`
+	rows, err := conn.Query(ctx, query, since.Unix(), since.Unix(), runQueryIDPrefix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := &serverStats{expected: len(latencies)}
+	kinds := make(map[string]*serverQueryStat)
+	for rows.Next() {
+		var (
+			id                                     string
+			finished                               uint8
+			duration, readRows, readBytes          uint64
+			writtenRows, writtenBytes, memory, cpu uint64
+		)
+		if err := rows.Scan(&id, &finished, &duration, &readRows, &readBytes, &writtenRows, &writtenBytes, &memory, &cpu); err != nil {
+			return nil, err
+		}
+		latency, ok := latencies[id]
+		if !ok {
+			continue
+		}
+		stats.found++
+
+		kind := queryKind(id)
+		stat := kinds[kind]
+		if stat == nil {
+			stat = &serverQueryStat{kind: kind, client: newLatencyHistogram(), server: newLatencyHistogram(), overhead: newLatencyHistogram()}
+			kinds[kind] = stat
+			stats.kinds = append(stats.kinds, stat)
+		}
+		stat.queries++
+		if finished == 0 {
+			stat.failed++
+			continue
+		}
+		server := time.Duration(duration) * time.Millisecond
+		stat.client.Add(latency)
+		stat.server.Add(server)
+		stat.overhead.Add(latency - server)
+		stat.readRows += readRows
+		stat.readBytes += readBytes
+		stat.writtenRows += writtenRows
+		stat.writtenBytes += writtenBytes
+		stat.memoryTotal += memory
+		if memory > stat.memoryPeak {
+			stat.memoryPeak = memory
+		}
+		stat.cpu += time.Duration(cpu) * time.Microsecond
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(stats.kinds, func(i, j int) bool { return stats.kinds[i].kind < stats.kinds[j].kind })
+	return stats, nil
+}
+
+// queryKind strips the run prefix and the sequence number off a query_id
+func queryKind(id string) string {
+	kind := strings.TrimPrefix(id, runQueryIDPrefix())
+	if i := strings.LastIndexByte(kind, '-'); i >= 0 {
+		kind = kind[:i]
+	}
+	return kind
+}
+
+// memoryMean is the mean memory usage of the successful queries
+func (s *serverQueryStat) memoryMean() uint64 {
+	succeeded := s.queries - s.failed
+	if succeeded == 0 {
+		return 0
+	}
+	return s.memoryTotal / uint64(succeeded)
+}
+
+func (s *serverStats) print() {
+	show.EmptyLine()
+	show.Info("Server stats from system.query_log: %d of %d queries found", s.found, s.expected)
+	if s.found < s.expected {
+		show.Warn("queries on other replicas or not yet logged are missing from system.query_log")
+	}
+	for _, stat := range s.kinds {
+		client, server, overhead := stat.client.Summary(), stat.server.Summary(), stat.overhead.Summary()
+		show.Info("%s: %d queries, %d failed on the server", stat.kind, stat.queries, stat.failed)
+		show.Info("%s latency (ms) p50 client: %.2f, server: %.2f, overhead: %.2f", stat.kind, client.P50, server.P50, overhead.P50)
+		show.Info("%s latency (ms) p99 client: %.2f, server: %.2f, overhead: %.2f", stat.kind, client.P99, server.P99, overhead.P99)
+		show.Info("%s server read rows: %d, read bytes: %.2f MB, written rows: %d, written bytes: %.2f MB",
+			stat.kind, stat.readRows, float64(stat.readBytes)/1024/1024, stat.writtenRows, float64(stat.writtenBytes)/1024/1024)
+		show.Info("%s server memory peak: %.2f MB, mean: %.2f MB, CPU time: %v",
+			stat.kind, float64(stat.memoryPeak)/1024/1024, float64(stat.memoryMean())/1024/1024, stat.cpu.Round(time.Millisecond))
+	}
+}
+
+// addTo adds metrics named like server_insert_latency_p99 and a table with one row per query kind
+func (s *serverStats) addTo(result *report.Result) {
+	result.AddMetric("server_queries_found", float64(s.found), "queries", true)
+
+	table := report.Table{
+		Name: "server_queries",
+		Columns: []string{"kind", "queries", "failed", "client_p50_ms", "server_p50_ms", "overhead_p50_ms",
+			"client_p99_ms", "server_p99_ms", "overhead_p99_ms", "read_rows", "read_bytes", "memory_peak_bytes", "cpu_seconds"},
+	}
+	for _, stat := range s.kinds {
+		prefix := "server_" + strings.ReplaceAll(stat.kind, ".", "_")
+		client, server, overhead := stat.client.Summary(), stat.server.Summary(), stat.overhead.Summary()
+		server.addMetrics(result, prefix)
+		overhead.addMetrics(result, prefix+"_overhead")
+		result.AddMetric(prefix+"_failed", float64(stat.failed), "queries", false)
+		result.AddMetric(prefix+"_read_rows", float64(stat.readRows), "rows", false)
+		result.AddMetric(prefix+"_read_bytes", float64(stat.readBytes), "bytes", false)
+		result.AddMetric(prefix+"_written_rows", float64(stat.writtenRows), "rows", true)
+		result.AddMetric(prefix+"_memory_peak", float64(stat.memoryPeak), "bytes", false)
+		result.AddMetric(prefix+"_memory_mean", float64(stat.memoryMean()), "bytes", false)
+		result.AddMetric(prefix+"_cpu_seconds", stat.cpu.Seconds(), "s", false)
+
+		table.Rows = append(table.Rows, []string{
+			stat.kind,
+			strconv.Itoa(stat.queries),
+			strconv.Itoa(stat.failed),
+			formatMillis(client.P50),
+			formatMillis(server.P50),
+			formatMillis(overhead.P50),
+			formatMillis(client.P99),
+			formatMillis(server.P99),
+			formatMillis(overhead.P99),
+			strconv.FormatUint(stat.readRows, 10),
+			strconv.FormatUint(stat.readBytes, 10),
+			strconv.FormatUint(stat.memoryPeak, 10),
+			strconv.FormatFloat(stat.cpu.Seconds(), 'f', 3, 64),
+		})
+	}
+	result.Tables = append(result.Tables, table)
+}
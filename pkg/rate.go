@@ -0,0 +1,107 @@
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pkg
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// rampStep is how often a ramping pacer adjusts its rate
+const rampStep = 100 * time.Millisecond
+
+// pacer hands out rows at a fixed rate. Every call reserves the next slot on a
+// shared schedule, so concurrent callers together never exceed the rate.
+type pacer struct {
+	sync.Mutex
+	rate float64 // rows per second, 0 means unlimited
+	next time.Time
+}
+
+func newPacer(rate float64) *pacer {
+	return &pacer{rate: rate}
+}
+
+// Rate returns the current rate in rows per second
+func (p *pacer) Rate() float64 {
+	p.Lock()
+	defer p.Unlock()
+	return p.rate
+}
+
+// SetRate changes the rate, the rows already scheduled keep their slot
+func (p *pacer) SetRate(rate float64) {
+	p.Lock()
+	defer p.Unlock()
+	p.rate = rate
+}
+
+// Ramp moves the rate linearly from one value to another over the duration
+func (p *pacer) Ramp(ctx context.Context, from, to float64, duration time.Duration) {
+	start := time.Now()
+	ticker := time.NewTicker(rampStep)
+	defer ticker.Stop()
+	for {
+		progress := float64(time.Since(start)) / float64(duration)
+		if progress >= 1 {
+			p.SetRate(to)
+			return
+		}
+		p.SetRate(from + (to-from)*progress)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Wait blocks until n rows may be written and returns the time they were scheduled for.
+func (p *pacer) Wait(ctx context.Context, n int) (time.Time, error) {
+	p.Lock()
+	if p.rate <= 0 {
+		p.Unlock()
+		return time.Now(), ctx.Err()
+	}
+
+	now := time.Now()
+	// Do not let an idle period turn into a burst later on
+	if p.next.Before(now) {
+		p.next = now
+	}
+	scheduled := p.next
+	p.next = p.next.Add(time.Duration(float64(n) / p.rate * float64(time.Second)))
+	p.Unlock()
+
+	wait := time.Until(scheduled)
+	if wait <= 0 {
+		return scheduled, ctx.Err()
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return scheduled, nil
+	case <-ctx.Done():
+		return scheduled, ctx.Err()
+	}
+}
@@ -21,21 +21,31 @@ package pkg
 import (
 	"context"
 	"fmt"
+	"math/rand"
 	"os"
 	"sort"
+	"strconv"
+	"sync"
 	"time"
 
+	"clickhouse-benchmark/pkg/report"
 	"clickhouse-benchmark/pkg/show"
 
-	"github.com/montanaflynn/stats"
+	ck "github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
 	"github.com/spf13/cobra"
 )
 
 type readOption struct {
-	startTime string
-	endTime   string
-	timeStep  string
-	sql       string
+	startTime   string
+	endTime     string
+	timeStep    string
+	sql         string
+	concurrency int
+	repeat      int
+	workload    string
+	settings    []string
+	interval    time.Duration
 }
 
 var readOpt readOption
@@ -44,7 +54,7 @@ var readCommand = &cobra.Command{
 	Use:  "read",
 	Long: ` benchmarking read `,
 	Run: func(cmd *cobra.Command, args []string) {
-		if err := benchmarkReadQueries(); err != nil {
+		if err := benchmarkReadQueries(cmd); err != nil {
 			show.Error("Error: %v\n", err)
 			os.Exit(1)
 		}
@@ -58,16 +68,47 @@ func init() {
 	readCommand.Flags().StringVar(&readOpt.endTime, "end", "2023-06-09 19:00:00", "end time")
 	readCommand.Flags().StringVar(&readOpt.timeStep, "step", "minute", "time step")
 	readCommand.Flags().StringVar(&readOpt.sql, "sql", "select * from test.metrics", "sql")
+	readCommand.Flags().IntVarP(&readOpt.concurrency, "concurrency", "c", 1, "number of workers sharing the connection pool")
+	readCommand.Flags().IntVar(&readOpt.repeat, "repeat", 1, "how many times every time step is queried")
+	readCommand.Flags().StringVarP(&readOpt.workload, "workload", "w", "", "YAML or JSON file with weighted query templates, replaces --sql")
+	readCommand.Flags().DurationVar(&readOpt.interval, "report-interval", 10*time.Second, "interval of the queries per second and latency report, 0 disables")
+	addSettingsFlag(readCommand, &readOpt.settings)
+	addQueryLogFlag(readCommand)
+	addSamplerFlag(readCommand)
+	addOutputFlags(readCommand)
 
 }
 
-func benchmarkReadQueries() error {
+type readTask struct {
+	bucket   int
+	name     string
+	query    string
+	settings ck.Settings
+}
+
+// queryMixStat is the outcome of one named workload query
+type queryMixStat struct {
+	failed  int
+	latency *latencyHistogram
+}
+
+func benchmarkReadQueries(cmd *cobra.Command) error {
+	if readOpt.concurrency <= 0 || readOpt.repeat <= 0 {
+		return fmt.Errorf("concurrency and repeat must be positive")
+	}
+	if readOpt.interval < 0 {
+		return fmt.Errorf("report interval must not be negative")
+	}
+	if err := outputOpt.validate(); err != nil {
+		return err
+	}
+
 	// Parse start and end times
-	startTime, err := time.Parse("2006-01-02 15:04:05", readOpt.startTime)
+	startTime, err := time.Parse(timeLayout, readOpt.startTime)
 	if err != nil {
 		return err
 	}
-	endTime, err := time.Parse("2006-01-02 15:04:05", readOpt.endTime)
+	endTime, err := time.Parse(timeLayout, readOpt.endTime)
 	if err != nil {
 		return err
 	}
@@ -88,82 +129,340 @@ func benchmarkReadQueries() error {
 	}
 
 	iterations := int(endTime.Sub(startTime) / duration)
-	failedQuery := 0
-	taskStart := time.Now()
 
-	// Construct time condition
-	timeCondition := fmt.Sprintf("timestamp > '%s' AND timestamp < '%s'", startTime.Format("2006-01-02 15:04:05"), endTime.Format("2006-01-02 15:04:05"))
-
-	conn, err := getConn(os.Getenv("CLICKHOUSE_URL"))
+	settings, err := parseSettings(readOpt.settings)
 	if err != nil {
 		return err
 	}
-	defer conn.Close()
 
-	results := make(map[int]float64)
-
-	for i := 1; i <= iterations; i++ {
-		t := startTime.Add(duration * time.Duration(i))
-		query := fmt.Sprintf("%s AND timestamp >= '%s' and timestamp < '%s'", timeCondition, t.Format("2006-01-02 15:04:05"), t.Add(duration).Format("2006-01-02 15:04:05"))
-		start := time.Now()
-		if debugFlag {
-			show.Debug("debug sql: %s", query)
-		}
-		rows, err := conn.Query(context.Background(), readOpt.sql+" WHERE "+query)
+	workload := newSingleQueryWorkload(readOpt.sql, startTime, endTime)
+	if readOpt.workload != "" {
+		workload, err = loadWorkload(readOpt.workload)
 		if err != nil {
-			failedQuery++
 			return err
 		}
-		defer rows.Close()
+	}
+	workload.applySettings(settings)
 
-		// Calculate query elapsed time
-		elapsed := time.Since(start).Seconds()
-		results[i] = elapsed
+	maxOpenConns, err := getIntEnv("MAX_OPEN_CONNS", 10)
+	if err != nil {
+		return err
+	}
+	if readOpt.concurrency > maxOpenConns {
+		show.Warn("concurrency %d is larger than MAX_OPEN_CONNS %d, workers will wait for connections", readOpt.concurrency, maxOpenConns)
 	}
 
-	totalTime := time.Since(taskStart)
+	conn, err := getConn(os.Getenv("CLICKHOUSE_URL"))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if protocol, _ := connProtocol(); protocol == httpProtocol {
+		show.Warn("the HTTP interface reports no progress, read rows and bytes stay 0")
+	}
 
-	printResults(results)
+	tasks := make(chan readTask)
+	go func() {
+		defer close(tasks)
+		r := rand.New(rand.NewSource(time.Now().UnixNano()))
+		for repeat := 0; repeat < readOpt.repeat; repeat++ {
+			for i := 1; i <= iterations; i++ {
+				t := startTime.Add(duration * time.Duration(i))
+				query := workload.pick(r)
+				tasks <- readTask{bucket: i, name: query.Name, query: query.render(t, t.Add(duration), duration), settings: query.settings}
+			}
+		}
+	}()
 
-	bucketSlice := mapToSlice(results)
+	document := newResult(cmd, conn, time.Now())
+	sampler := startServerSampler(conn, document.StartedAt)
+	result := runReadTasks(conn, workload, readOpt.concurrency, readOpt.interval, tasks)
+	sampler.Stop()
 
-	p50, _ := stats.Percentile(bucketSlice, 50)
-	p80, _ := stats.Percentile(bucketSlice, 80)
-	p99, _ := stats.Percentile(bucketSlice, 99)
-	p999, _ := stats.Percentile(bucketSlice, 99.9)
+	printResults(result.results)
 
-	show.Info("p50: %v, p80: %v, p99: %v, p999: %v", p50, p80, p99, p999)
+	result.print()
 
 	// Print benchmarking results
 	show.EmptyLine()
 	show.Info("ClickHouse URL: %s", os.Getenv("CLICKHOUSE_URL"))
-	show.Info("Total queries executed: %d", iterations)
-	show.Info("Failed requests: %d", failedQuery)
-	show.Info("Time taken for tests: %v", totalTime)
+	show.Info("Concurrency: %d", readOpt.concurrency)
+	show.Info("Total queries executed: %d", result.executed)
+	show.Info("Failed requests: %d", result.failed)
+	show.Info("Time taken for tests: %v", result.elapsed)
+	result.printThroughput()
+	sampler.print()
+
+	result.addTo(document, "", document.StartedAt)
+	document.Tables = append(document.Tables, bucketTable(result.results))
+	sampler.addTo(document)
+	captureServerStats(conn, document)
+	return publishResult(conn, document)
+}
+
+// readResult is the outcome of one read run
+type readResult struct {
+	elapsed   time.Duration
+	executed  int
+	failed    int
+	total     queryStat
+	results   map[int]*latencyHistogram // last row latency by bucket, a sample per repeat
+	firstRow  *latencyHistogram
+	latency   *latencyHistogram
+	queries   []WorkloadQuery
+	mix       map[string]*queryMixStat
+	intervals []QueryIntervalStat
+}
+
+// runReadTasks executes the tasks on concurrent workers that share the
+// connection pool and reports the queries every interval, 0 disables that
+func runReadTasks(conn driver.Conn, workload *Workload, concurrency int, interval time.Duration, tasks <-chan readTask) *readResult {
+	var mu sync.Mutex
+	result := &readResult{
+		results:  make(map[int]*latencyHistogram),
+		firstRow: newLatencyHistogram(),
+		latency:  newLatencyHistogram(),
+		queries:  workload.Queries,
+		mix:      make(map[string]*queryMixStat),
+	}
+	for _, query := range workload.Queries {
+		result.mix[query.Name] = &queryMixStat{latency: newLatencyHistogram()}
+	}
+
+	recorder := newQueryRecorder(interval)
+	recorder.Start()
+	taskStart := time.Now()
+
+	wg := sync.WaitGroup{}
+	wg.Add(concurrency)
+	for w := 0; w < concurrency; w++ {
+		go func() {
+			defer wg.Done()
+			for task := range tasks {
+				if debugFlag {
+					show.Debug("debug sql: %s", task.query)
+				}
+				stat, err := runReadQuery(conn, task)
+
+				mu.Lock()
+				result.executed++
+				if err != nil {
+					result.failed++
+					result.mix[task.name].failed++
+					show.Error("query %s of bucket %d failed: %v", task.name, task.bucket, err)
+				} else {
+					bucket := result.results[task.bucket]
+					if bucket == nil {
+						bucket = newLatencyHistogram()
+						result.results[task.bucket] = bucket
+					}
+					bucket.Add(stat.lastRow)
+					result.total.rows += stat.rows
+					result.total.bytes += stat.bytes
+					result.total.readRows += stat.readRows
+					result.total.readBytes += stat.readBytes
+				}
+				mu.Unlock()
 
-	return nil
+				if err != nil {
+					recorder.Fail()
+				} else {
+					recorder.Add(stat.lastRow)
+					result.firstRow.Add(stat.firstRow)
+					result.latency.Add(stat.lastRow)
+					result.mix[task.name].latency.Add(stat.lastRow)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	result.elapsed = time.Since(taskStart)
+	result.intervals = recorder.Stop()
+	return result
 }
 
-func mapToSlice(results map[int]float64) []float64 {
-	slice := make([]float64, 0, len(results))
+func (r *readResult) print() {
+	r.firstRow.Print("First row")
+	r.latency.Print("Last row")
 
-	for _, value := range results {
-		slice = append(slice, value)
+	// Print the latency of every workload query
+	if len(r.queries) > 1 {
+		show.EmptyLine()
+		for _, query := range r.queries {
+			stat := r.mix[query.Name]
+			summary := stat.latency.Summary()
+			show.Info("query %s: executed: %d, failed: %d, p50: %.2f ms, p80: %.2f ms, p99: %.2f ms, p999: %.2f ms",
+				query.Name, summary.Count+stat.failed, stat.failed, summary.P50, summary.P80, summary.P99, summary.P999)
+		}
 	}
+}
 
-	return slice
+func (r *readResult) printThroughput() {
+	seconds := r.elapsed.Seconds()
+	show.Info("Queries per second (executed, failed included): %.2f", r.queriesPerSecond())
+	show.Info("Rows returned: %d, %.0f rows/s", r.total.rows, float64(r.total.rows)/seconds)
+	show.Info("Bytes returned: %.2f MB, %.2f MB/s", float64(r.total.bytes)/1024/1024, float64(r.total.bytes)/1024/1024/seconds)
+	show.Info("Server read rows: %d, read bytes: %.2f MB", r.total.readRows, float64(r.total.readBytes)/1024/1024)
 }
 
-func printResults(results map[int]float64) {
+// addTo adds the metrics, the per query latencies and the interval series to
+// the result document, the names get the prefix and the offsets are measured from clock
+func (r *readResult) addTo(result *report.Result, prefix string, clock time.Time) {
+	seconds := r.elapsed.Seconds()
+	result.AddMetric(prefix+"read_elapsed", seconds, "s", false)
+	result.AddMetric(prefix+"queries", float64(r.executed), "queries", true)
+	result.AddMetric(prefix+"failed_queries", float64(r.failed), "queries", false)
+	result.AddMetric(prefix+"queries_per_second", r.queriesPerSecond(), "queries/s", true)
+	result.AddMetric(prefix+"rows_returned", float64(r.total.rows), "rows", true)
+	result.AddMetric(prefix+"bytes_returned", float64(r.total.bytes), "bytes", true)
+	result.AddMetric(prefix+"rows_returned_per_second", float64(r.total.rows)/seconds, "rows/s", true)
+	result.AddMetric(prefix+"server_read_rows", float64(r.total.readRows), "rows", false)
+	result.AddMetric(prefix+"server_read_bytes", float64(r.total.readBytes), "bytes", false)
+	r.firstRow.Summary().addMetrics(result, prefix+"first_row")
+	r.latency.Summary().addMetrics(result, prefix+"query")
+
+	table := report.Table{
+		Name:    prefix + "queries",
+		Columns: []string{"query", "executed", "failed", "p50_ms", "p80_ms", "p99_ms", "p999_ms"},
+	}
+	for _, query := range r.queries {
+		stat := r.mix[query.Name]
+		summary := stat.latency.Summary()
+		table.Rows = append(table.Rows, []string{
+			query.Name,
+			strconv.Itoa(summary.Count + stat.failed),
+			strconv.Itoa(stat.failed),
+			formatMillis(summary.P50),
+			formatMillis(summary.P80),
+			formatMillis(summary.P99),
+			formatMillis(summary.P999),
+		})
+	}
+	result.Tables = append(result.Tables, table)
+
+	if len(r.intervals) == 0 {
+		return
+	}
+	series := report.Series{
+		Name:   prefix + "read_intervals",
+		Fields: []string{"queries", "failed_queries", "queries_per_second", "p50_ms", "p99_ms"},
+	}
+	for _, interval := range r.intervals {
+		end := interval.Start.Add(interval.Elapsed)
+		series.Points = append(series.Points, report.Point{
+			Time:   end,
+			Offset: end.Sub(clock).Seconds(),
+			Values: []float64{float64(interval.Queries), float64(interval.Failed), interval.Rate, interval.Latency.P50, interval.Latency.P99},
+		})
+	}
+	result.Series = append(result.Series, series)
+}
+
+// queriesPerSecond counts the executed queries, failed ones included, like
+// the rate of the read intervals
+func (r *readResult) queriesPerSecond() float64 {
+	return float64(r.executed) / r.elapsed.Seconds()
+}
+
+// queryStat is what one read query cost the client and the server
+type queryStat struct {
+	firstRow  time.Duration // time to first row
+	lastRow   time.Duration // time to last row, the whole query
+	rows      uint64        // rows returned to the client
+	bytes     uint64        // bytes returned to the client, reported by the server profile info
+	readRows  uint64        // rows read by the server, reported by the progress packets
+	readBytes uint64        // bytes read by the server, reported by the progress packets
+}
+
+// runReadQuery executes the query with its settings and drains the result set
+func runReadQuery(conn driver.Conn, task readTask) (queryStat, error) {
+	var (
+		mu   sync.Mutex
+		stat queryStat
+	)
+	ctx := ck.Context(withQueryID(context.Background(), "read."+task.name),
+		ck.WithSettings(mergeSettings(task.settings)),
+		ck.WithProgress(func(p *ck.Progress) {
+			mu.Lock()
+			stat.readRows += p.Rows
+			stat.readBytes += p.Bytes
+			mu.Unlock()
+		}),
+		ck.WithProfileInfo(func(p *ck.ProfileInfo) {
+			mu.Lock()
+			stat.bytes += p.Bytes
+			mu.Unlock()
+		}),
+	)
+
+	start := time.Now()
+	rows, err := conn.Query(ctx, task.query)
+	if err != nil {
+		return stat, err
+	}
+	defer rows.Close()
+
+	var returned uint64
+	for rows.Next() {
+		if returned == 0 {
+			stat.firstRow = time.Since(start)
+		}
+		returned++
+	}
+	if err := rows.Err(); err != nil {
+		return stat, err
+	}
+	if err := rows.Close(); err != nil {
+		return stat, err
+	}
+
+	// Calculate query elapsed time
+	elapsed := time.Since(start)
+	recordQuery(ctx, elapsed)
+
+	mu.Lock()
+	defer mu.Unlock()
+	stat.lastRow = elapsed
+	if returned == 0 {
+		stat.firstRow = elapsed
+	}
+	stat.rows = returned
+	return stat, nil
+}
+
+// bucketTable lists the last row latency of every time step over its repeats
+func bucketTable(results map[int]*latencyHistogram) report.Table {
+	table := report.Table{Name: "buckets", Columns: []string{"bucket", "queries", "mean_ms", "p99_ms", "max_ms"}}
+	for _, bucket := range sortedBuckets(results) {
+		summary := results[bucket].Summary()
+		table.Rows = append(table.Rows, []string{
+			strconv.Itoa(bucket),
+			strconv.Itoa(summary.Count),
+			formatMillis(summary.Mean),
+			formatMillis(summary.P99),
+			formatMillis(summary.Max),
+		})
+	}
+	return table
+}
+
+func sortedBuckets(results map[int]*latencyHistogram) []int {
 	keys := make([]int, 0, len(results))
 	for key := range results {
 		keys = append(keys, key)
 	}
-
 	sort.Ints(keys)
+	return keys
+}
+
+func formatMillis(value float64) string {
+	return strconv.FormatFloat(value, 'f', 3, 64)
+}
 
-	for _, bucket := range keys {
-		bucketResults := results[bucket]
-		show.Info("bucket: %v, elapsed: %v", bucket, bucketResults)
+func printResults(results map[int]*latencyHistogram) {
+	for _, bucket := range sortedBuckets(results) {
+		summary := results[bucket].Summary()
+		show.Info("bucket: %d, queries: %d, mean: %.2f ms, p99: %.2f ms, max: %.2f ms", bucket, summary.Count, summary.Mean, summary.P99, summary.Max)
 	}
 }
@@ -0,0 +1,94 @@
+package report
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Threshold is the largest regression in percent allowed for the metrics matching Pattern
+type Threshold struct {
+	Pattern string // metric name or a path.Match pattern like *latency_p99
+	Percent float64
+}
+
+// ParseThreshold parses "pattern=percent", the percent sign is optional
+func ParseThreshold(value string) (Threshold, error) {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return Threshold{}, fmt.Errorf("invalid threshold %q, expected pattern=percent", value)
+	}
+	if _, err := path.Match(parts[0], ""); err != nil {
+		return Threshold{}, fmt.Errorf("invalid threshold pattern %q: %v", parts[0], err)
+	}
+
+	percent, err := strconv.ParseFloat(strings.TrimSuffix(parts[1], "%"), 64)
+	if err != nil || percent < 0 {
+		return Threshold{}, fmt.Errorf("invalid threshold percent %q", parts[1])
+	}
+	return Threshold{Pattern: parts[0], Percent: percent}, nil
+}
+
+// Delta is the change of one metric between two results
+type Delta struct {
+	Name           string
+	Unit           string
+	Base           float64
+	Current        float64
+	Change         float64 // relative change in percent, +Inf when the base is zero
+	HigherIsBetter bool
+	Threshold      *Threshold
+}
+
+// Regression is the change in percent towards the worse direction, negative when the metric improved
+func (d Delta) Regression() float64 {
+	if d.Base == d.Current {
+		return 0
+	}
+	if d.HigherIsBetter {
+		return -d.Change
+	}
+	return d.Change
+}
+
+// Regressed reports whether the regression exceeds the threshold of the metric
+func (d Delta) Regressed() bool {
+	return d.Threshold != nil && d.Regression() > d.Threshold.Percent
+}
+
+// Compare pairs the metrics present in both results, the first matching threshold applies to a metric
+func Compare(base, current *Result, thresholds []Threshold) []Delta {
+	deltas := make([]Delta, 0, len(current.Metrics))
+	for _, metric := range current.Metrics {
+		baseMetric, ok := base.Metric(metric.Name)
+		if !ok {
+			continue
+		}
+
+		delta := Delta{
+			Name:           metric.Name,
+			Unit:           metric.Unit,
+			Base:           baseMetric.Value,
+			Current:        metric.Value,
+			HigherIsBetter: metric.HigherIsBetter,
+		}
+		switch {
+		case delta.Base == delta.Current:
+		case delta.Base == 0:
+			delta.Change = math.Copysign(math.Inf(1), delta.Current)
+		default:
+			delta.Change = (delta.Current - delta.Base) / math.Abs(delta.Base) * 100
+		}
+
+		for i := range thresholds {
+			if matched, _ := path.Match(thresholds[i].Pattern, metric.Name); matched {
+				delta.Threshold = &thresholds[i]
+				break
+			}
+		}
+		deltas = append(deltas, delta)
+	}
+	return deltas
+}
@@ -0,0 +1,160 @@
+package report
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		name           string
+		base, current  float64
+		higherIsBetter bool
+		thresholds     []Threshold
+		change         float64
+		regression     float64
+		threshold      string // pattern of the matched threshold, empty for none
+		regressed      bool
+	}{
+		{
+			name: "latency up regresses", base: 100, current: 130,
+			thresholds: []Threshold{{Pattern: "metric", Percent: 20}},
+			change:     30, regression: 30, threshold: "metric", regressed: true,
+		},
+		{
+			name: "latency down improves", base: 100, current: 70,
+			thresholds: []Threshold{{Pattern: "metric", Percent: 20}},
+			change:     -30, regression: -30, threshold: "metric",
+		},
+		{
+			name: "throughput down regresses", base: 1000, current: 700, higherIsBetter: true,
+			thresholds: []Threshold{{Pattern: "metric", Percent: 20}},
+			change:     -30, regression: 30, threshold: "metric", regressed: true,
+		},
+		{
+			name: "throughput up improves", base: 1000, current: 1300, higherIsBetter: true,
+			thresholds: []Threshold{{Pattern: "metric", Percent: 20}},
+			change:     30, regression: -30, threshold: "metric",
+		},
+		{
+			name: "within threshold", base: 100, current: 110,
+			thresholds: []Threshold{{Pattern: "metric", Percent: 20}},
+			change:     10, regression: 10, threshold: "metric",
+		},
+		{
+			name: "no threshold never regresses", base: 100, current: 200,
+			change: 100, regression: 100,
+		},
+		{
+			name: "zero baseline grows", base: 0, current: 5,
+			thresholds: []Threshold{{Pattern: "metric", Percent: 20}},
+			change:     math.Inf(1), regression: math.Inf(1), threshold: "metric", regressed: true,
+		},
+		{
+			name: "zero baseline grows for higher is better", base: 0, current: 5, higherIsBetter: true,
+			thresholds: []Threshold{{Pattern: "metric", Percent: 20}},
+			change:     math.Inf(1), regression: math.Inf(-1), threshold: "metric",
+		},
+		{
+			name: "zero baseline stays zero", base: 0, current: 0,
+			thresholds: []Threshold{{Pattern: "metric", Percent: 0}},
+			threshold:  "metric",
+		},
+		{
+			name: "first matching threshold wins", base: 100, current: 115,
+			thresholds: []Threshold{{Pattern: "met*", Percent: 10}, {Pattern: "metric", Percent: 50}},
+			change:     15, regression: 15, threshold: "met*", regressed: true,
+		},
+		{
+			name: "exact name before glob", base: 100, current: 115,
+			thresholds: []Threshold{{Pattern: "metric", Percent: 50}, {Pattern: "*", Percent: 10}},
+			change:     15, regression: 15, threshold: "metric",
+		},
+		{
+			name: "glob that does not match is skipped", base: 100, current: 115,
+			thresholds: []Threshold{{Pattern: "*latency_p99", Percent: 10}, {Pattern: "*", Percent: 20}},
+			change:     15, regression: 15, threshold: "*",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			base := New("write", time.Time{})
+			base.AddMetric("metric", test.base, "ms", test.higherIsBetter)
+			current := New("write", time.Time{})
+			current.AddMetric("metric", test.current, "ms", test.higherIsBetter)
+
+			deltas := Compare(base, current, test.thresholds)
+			if len(deltas) != 1 {
+				t.Fatalf("got %d deltas, want 1", len(deltas))
+			}
+			delta := deltas[0]
+			if !closeTo(delta.Change, test.change) {
+				t.Errorf("change = %v, want %v", delta.Change, test.change)
+			}
+			if !closeTo(delta.Regression(), test.regression) {
+				t.Errorf("regression = %v, want %v", delta.Regression(), test.regression)
+			}
+			var pattern string
+			if delta.Threshold != nil {
+				pattern = delta.Threshold.Pattern
+			}
+			if pattern != test.threshold {
+				t.Errorf("threshold = %q, want %q", pattern, test.threshold)
+			}
+			if delta.Regressed() != test.regressed {
+				t.Errorf("regressed = %v, want %v", delta.Regressed(), test.regressed)
+			}
+		})
+	}
+}
+
+func TestCompareSkipsMissingMetrics(t *testing.T) {
+	base := New("write", time.Time{})
+	base.AddMetric("only_base", 1, "ms", false)
+	base.AddMetric("both", 1, "ms", false)
+	current := New("write", time.Time{})
+	current.AddMetric("both", 2, "ms", false)
+	current.AddMetric("only_current", 1, "ms", false)
+
+	deltas := Compare(base, current, nil)
+	if len(deltas) != 1 || deltas[0].Name != "both" {
+		t.Errorf("deltas = %+v, want only both", deltas)
+	}
+}
+
+func TestParseThreshold(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Threshold
+		wantErr bool
+	}{
+		{value: "write_rows_per_second=5", want: Threshold{Pattern: "write_rows_per_second", Percent: 5}},
+		{value: "*latency_p99=10%", want: Threshold{Pattern: "*latency_p99", Percent: 10}},
+		{value: "*=0", want: Threshold{Pattern: "*", Percent: 0}},
+		{value: "metric", wantErr: true},
+		{value: "=5", wantErr: true},
+		{value: "metric=-1", wantErr: true},
+		{value: "metric=fast", wantErr: true},
+		{value: "[=5", wantErr: true},
+	}
+
+	for _, test := range tests {
+		threshold, err := ParseThreshold(test.value)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ParseThreshold(%q) error = %v, want error %v", test.value, err, test.wantErr)
+			continue
+		}
+		if threshold != test.want {
+			t.Errorf("ParseThreshold(%q) = %+v, want %+v", test.value, threshold, test.want)
+		}
+	}
+}
+
+func closeTo(a, b float64) bool {
+	if math.IsInf(a, 0) || math.IsInf(b, 0) {
+		return a == b
+	}
+	return math.Abs(a-b) < 1e-9
+}
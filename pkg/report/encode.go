@@ -0,0 +1,209 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Supported output formats
+const (
+	FormatJSON     = "json"
+	FormatCSV      = "csv"
+	FormatMarkdown = "markdown"
+)
+
+// FormatFromPath guesses the format from the file extension, JSON is the fallback
+func FormatFromPath(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return FormatCSV
+	case ".md", ".markdown":
+		return FormatMarkdown
+	default:
+		return FormatJSON
+	}
+}
+
+// WriteFile encodes the result into path, "-" means stdout
+func WriteFile(r *Result, path, format string) error {
+	if path == "-" {
+		return Encode(os.Stdout, r, format)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := Encode(file, r, format); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// ReadFile decodes a result written in the JSON format
+func ReadFile(path string) (*Result, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{}
+	if err := json.Unmarshal(content, result); err != nil {
+		return nil, fmt.Errorf("failed to parse result file %s: %v", path, err)
+	}
+	return result, nil
+}
+
+// Encode writes the result in the given format
+func Encode(w io.Writer, r *Result, format string) error {
+	switch format {
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(r)
+	case FormatCSV:
+		return encodeCSV(w, r)
+	case FormatMarkdown:
+		return encodeMarkdown(w, r)
+	default:
+		return fmt.Errorf("invalid output format: %s", format)
+	}
+}
+
+// encodeCSV flattens the result into one long table so every section can be filtered by the first column
+func encodeCSV(w io.Writer, r *Result) error {
+	writer := csv.NewWriter(w)
+	records := [][]string{
+		{"section", "group", "key", "field", "value", "unit"},
+		{"run", "", "command", "", r.Command, ""},
+		{"run", "", "run_id", "", r.RunID, ""},
+		{"run", "", "started_at", "", r.StartedAt.Format("2006-01-02T15:04:05.000Z07:00"), ""},
+		{"run", "", "elapsed", "", formatFloat(r.Elapsed), "s"},
+	}
+
+	for _, name := range sortedKeys(r.Parameters) {
+		records = append(records, []string{"parameter", "", name, "", r.Parameters[name], ""})
+	}
+	for _, field := range r.Environment.fields() {
+		records = append(records, []string{"environment", "", field[0], "", field[1], ""})
+	}
+	for _, metric := range r.Metrics {
+		records = append(records, []string{"metric", "", metric.Name, "", formatFloat(metric.Value), metric.Unit})
+	}
+	for _, series := range r.Series {
+		for _, point := range series.Points {
+			for i, field := range series.Fields {
+				records = append(records, []string{"series", series.Name, formatFloat(point.Offset), field, formatFloat(point.Values[i]), ""})
+			}
+		}
+	}
+	for _, table := range r.Tables {
+		for i, row := range table.Rows {
+			for j, column := range table.Columns {
+				records = append(records, []string{"table", table.Name, strconv.Itoa(i + 1), column, row[j], ""})
+			}
+		}
+	}
+
+	if err := writer.WriteAll(records); err != nil {
+		return err
+	}
+	return writer.Error()
+}
+
+func encodeMarkdown(w io.Writer, r *Result) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# %s benchmark\n\n", r.Command)
+	fmt.Fprintf(&b, "- Run ID: %s\n", r.RunID)
+	fmt.Fprintf(&b, "- Started at: %s\n", r.StartedAt.Format("2006-01-02 15:04:05 Z07:00"))
+	fmt.Fprintf(&b, "- Elapsed: %s s\n\n", formatFloat(r.Elapsed))
+
+	b.WriteString("## Parameters\n\n")
+	parameters := make([][]string, 0, len(r.Parameters))
+	for _, name := range sortedKeys(r.Parameters) {
+		parameters = append(parameters, []string{name, r.Parameters[name]})
+	}
+	writeMarkdownTable(&b, []string{"Name", "Value"}, parameters)
+
+	b.WriteString("## Environment\n\n")
+	environment := make([][]string, 0)
+	for _, field := range r.Environment.fields() {
+		environment = append(environment, []string{field[0], field[1]})
+	}
+	writeMarkdownTable(&b, []string{"Name", "Value"}, environment)
+
+	b.WriteString("## Metrics\n\n")
+	metrics := make([][]string, 0, len(r.Metrics))
+	for _, metric := range r.Metrics {
+		metrics = append(metrics, []string{metric.Name, formatFloat(metric.Value), metric.Unit})
+	}
+	writeMarkdownTable(&b, []string{"Metric", "Value", "Unit"}, metrics)
+
+	for _, series := range r.Series {
+		fmt.Fprintf(&b, "## Series %s\n\n", series.Name)
+		rows := make([][]string, 0, len(series.Points))
+		for _, point := range series.Points {
+			row := []string{formatFloat(point.Offset)}
+			for _, value := range point.Values {
+				row = append(row, formatFloat(value))
+			}
+			rows = append(rows, row)
+		}
+		writeMarkdownTable(&b, append([]string{"offset_seconds"}, series.Fields...), rows)
+	}
+
+	for _, table := range r.Tables {
+		fmt.Fprintf(&b, "## %s\n\n", table.Name)
+		writeMarkdownTable(&b, table.Columns, table.Rows)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeMarkdownTable(b *strings.Builder, columns []string, rows [][]string) {
+	b.WriteString("| " + strings.Join(columns, " | ") + " |\n")
+	b.WriteString("|" + strings.Repeat(" --- |", len(columns)) + "\n")
+	for _, row := range rows {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			cells[i] = strings.ReplaceAll(cell, "|", "\\|")
+		}
+		b.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+	}
+	b.WriteString("\n")
+}
+
+func (e Environment) fields() [][2]string {
+	return [][2]string{
+		{"clickhouse_url", e.ClickHouseURL},
+		{"server_version", e.ServerVersion},
+		{"hostname", e.Hostname},
+		{"go_version", e.GoVersion},
+		{"os", e.OS},
+		{"arch", e.Arch},
+		{"cpus", strconv.Itoa(e.CPUs)},
+	}
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
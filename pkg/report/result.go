@@ -0,0 +1,96 @@
+package report
+
+import (
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Result is the machine readable outcome of one benchmark run
+type Result struct {
+	Command     string            `json:"command"`
+	RunID       string            `json:"run_id"`
+	StartedAt   time.Time         `json:"started_at"`
+	Elapsed     float64           `json:"elapsed_seconds"`
+	Parameters  map[string]string `json:"parameters"`
+	Environment Environment       `json:"environment"`
+	Metrics     []Metric          `json:"metrics"`
+	Series      []Series          `json:"series,omitempty"`
+	Tables      []Table           `json:"tables,omitempty"`
+}
+
+// Environment describes where the run happened
+type Environment struct {
+	ClickHouseURL string `json:"clickhouse_url"`
+	ServerVersion string `json:"server_version,omitempty"`
+	Hostname      string `json:"hostname"`
+	GoVersion     string `json:"go_version"`
+	OS            string `json:"os"`
+	Arch          string `json:"arch"`
+	CPUs          int    `json:"cpus"`
+}
+
+// Metric is a single summary value of the run
+type Metric struct {
+	Name           string  `json:"name"`
+	Value          float64 `json:"value"`
+	Unit           string  `json:"unit,omitempty"`
+	HigherIsBetter bool    `json:"higher_is_better"`
+}
+
+// Series is a time series sampled during the run, Values of every point line up with Fields
+type Series struct {
+	Name   string   `json:"name"`
+	Fields []string `json:"fields"`
+	Points []Point  `json:"points"`
+}
+
+// Point is one sample of a series
+type Point struct {
+	Time   time.Time `json:"time"`
+	Offset float64   `json:"offset_seconds"` // seconds since the start of the run
+	Values []float64 `json:"values"`
+}
+
+// Table holds tabular details like partitions or per query latencies
+type Table struct {
+	Name    string     `json:"name"`
+	Columns []string   `json:"columns"`
+	Rows    [][]string `json:"rows"`
+}
+
+// New starts a result for the command with a fresh run id
+func New(command string, startedAt time.Time) *Result {
+	hostname, _ := os.Hostname()
+	return &Result{
+		Command:    command,
+		RunID:      uuid.New().String(),
+		StartedAt:  startedAt,
+		Parameters: make(map[string]string),
+		Environment: Environment{
+			ClickHouseURL: os.Getenv("CLICKHOUSE_URL"),
+			Hostname:      hostname,
+			GoVersion:     runtime.Version(),
+			OS:            runtime.GOOS,
+			Arch:          runtime.GOARCH,
+			CPUs:          runtime.NumCPU(),
+		},
+	}
+}
+
+// AddMetric appends a summary value
+func (r *Result) AddMetric(name string, value float64, unit string, higherIsBetter bool) {
+	r.Metrics = append(r.Metrics, Metric{Name: name, Value: value, Unit: unit, HigherIsBetter: higherIsBetter})
+}
+
+// Metric looks a summary value up by name
+func (r *Result) Metric(name string) (Metric, bool) {
+	for _, metric := range r.Metrics {
+		if metric.Name == name {
+			return metric, true
+		}
+	}
+	return Metric{}, false
+}
@@ -0,0 +1,192 @@
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"clickhouse-benchmark/pkg/clickhouse"
+	"clickhouse-benchmark/pkg/report"
+	"clickhouse-benchmark/pkg/show"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/google/uuid"
+)
+
+const (
+	resultKindMetric = "metric"
+	resultKindSeries = "series"
+)
+
+// resultsTableDDL keeps one row per summary metric and one row per series value
+const resultsTableDDL = `CREATE TABLE IF NOT EXISTS %s.%s
+(
+    run_id         UUID,
+    command        LowCardinality(String),
+    started_at     DateTime64(3),
+    hostname       LowCardinality(String),
+    server_version LowCardinality(String),
+    parameters     Map(String, String),
+    kind           Enum8('metric' = 1, 'series' = 2),
+    series         LowCardinality(String),
+    sampled_at     DateTime64(3),
+    offset_seconds Float64,
+    name           LowCardinality(String),
+    value          Float64,
+    unit           LowCardinality(String)
+)
+ENGINE = MergeTree
+PARTITION BY toYYYYMM(started_at)
+ORDER BY (command, started_at, run_id, kind, series, name, offset_seconds)`
+
+// ResultRow is one row of the results table
+type ResultRow struct {
+	RunID         uuid.UUID         `ch:"run_id"`
+	Command       string            `ch:"command"`
+	StartedAt     time.Time         `ch:"started_at"`
+	Hostname      string            `ch:"hostname"`
+	ServerVersion string            `ch:"server_version"`
+	Parameters    map[string]string `ch:"parameters"`
+	Kind          string            `ch:"kind"`
+	Series        string            `ch:"series"`
+	SampledAt     time.Time         `ch:"sampled_at"`
+	Offset        float64           `ch:"offset_seconds"`
+	Name          string            `ch:"name"`
+	Value         float64           `ch:"value"`
+	Unit          string            `ch:"unit"`
+}
+
+// RowValues returns the values in the column order of the results table, inserts over HTTP need them
+func (r *ResultRow) RowValues() []interface{} {
+	return []interface{}{
+		r.RunID, r.Command, r.StartedAt, r.Hostname, r.ServerVersion, r.Parameters,
+		r.Kind, r.Series, r.SampledAt, r.Offset, r.Name, r.Value, r.Unit,
+	}
+}
+
+var resultsTable string
+
+func init() {
+	root.PersistentFlags().StringVar(&resultsTable, "results-table", "", "store the results in this db.table, defaults to the RESULTS_TABLE env")
+}
+
+// resultsTarget returns the database and table for the results, empty when persisting is disabled
+func resultsTarget() (string, string, error) {
+	target := resultsTable
+	if target == "" {
+		target = os.Getenv("RESULTS_TABLE")
+	}
+	if target == "" {
+		return "", "", nil
+	}
+
+	parts := strings.Split(target, ".")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid results table %q, expected db.table", target)
+	}
+	return parts[0], parts[1], nil
+}
+
+// createResultsTable creates the results database and table when persisting is enabled
+func createResultsTable(conn driver.Conn) error {
+	database, table, err := resultsTarget()
+	if err != nil || database == "" {
+		return err
+	}
+
+	if err := conn.Exec(context.Background(), fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s", database)); err != nil {
+		return fmt.Errorf("failed to create results database: %v", err)
+	}
+	if err := conn.Exec(context.Background(), fmt.Sprintf(resultsTableDDL, database, table)); err != nil {
+		return fmt.Errorf("failed to create results table: %v", err)
+	}
+
+	show.Info("Results table %s.%s created successfully \n\n", database, table)
+	return nil
+}
+
+// persistResult inserts the summary metrics and the series of the result into the results table
+func persistResult(conn driver.Conn, result *report.Result) error {
+	database, table, err := resultsTarget()
+	if err != nil || database == "" {
+		return err
+	}
+
+	runID, err := uuid.Parse(result.RunID)
+	if err != nil {
+		return err
+	}
+
+	batch, err := clickhouse.Prepare(context.Background(), conn, database, table)
+	if err != nil {
+		return fmt.Errorf("failed to prepare results batch: %v", err)
+	}
+
+	base := ResultRow{
+		RunID:         runID,
+		Command:       result.Command,
+		StartedAt:     result.StartedAt,
+		Hostname:      result.Environment.Hostname,
+		ServerVersion: result.Environment.ServerVersion,
+		Parameters:    result.Parameters,
+	}
+
+	for _, metric := range result.Metrics {
+		row := base
+		row.Kind = resultKindMetric
+		row.SampledAt = result.StartedAt
+		row.Name = metric.Name
+		row.Value = metric.Value
+		row.Unit = metric.Unit
+		if err := batch.AppendStruct(&row); err != nil {
+			batch.Abort()
+			return fmt.Errorf("failed to append result metric %s: %v", metric.Name, err)
+		}
+	}
+
+	for _, series := range result.Series {
+		for _, point := range series.Points {
+			for i, field := range series.Fields {
+				row := base
+				row.Kind = resultKindSeries
+				row.Series = series.Name
+				row.SampledAt = point.Time
+				row.Offset = point.Offset
+				row.Name = field
+				row.Value = point.Values[i]
+				if err := batch.AppendStruct(&row); err != nil {
+					batch.Abort()
+					return fmt.Errorf("failed to append result series %s: %v", series.Name, err)
+				}
+			}
+		}
+	}
+
+	rows := batch.TotalRows()
+	if err := batch.Send(); err != nil {
+		return fmt.Errorf("failed to store the results: %v", err)
+	}
+
+	show.Info("Stored %d result rows of run %s in %s.%s", rows, result.RunID, database, table)
+	return nil
+}
@@ -0,0 +1,240 @@
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"clickhouse-benchmark/pkg/report"
+	"clickhouse-benchmark/pkg/show"
+
+	"github.com/spf13/cobra"
+)
+
+type runOption struct {
+	scenario string
+}
+
+var runOpt runOption
+
+var runCommand = &cobra.Command{
+	Use:  "run",
+	Long: ` run a scenario of mixed read and write phases`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runScenario(cmd); err != nil {
+			show.Error("Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	root.AddCommand(runCommand)
+
+	runCommand.Flags().StringVarP(&runOpt.scenario, "scenario", "s", "", "YAML scenario file describing the phases")
+	_ = runCommand.MarkFlagRequired("scenario")
+	addQueryLogFlag(runCommand)
+	addSamplerFlag(runCommand)
+	addOutputFlags(runCommand)
+}
+
+// phaseResult is the outcome of one scenario phase
+type phaseResult struct {
+	phase   *Phase
+	offset  time.Duration // start of the phase on the scenario clock
+	elapsed time.Duration // until its writers and readers stopped
+	write   *writeResult
+	read    *readResult
+}
+
+func runScenario(cmd *cobra.Command) error {
+	scenario, err := loadScenario(runOpt.scenario)
+	if err != nil {
+		return err
+	}
+	if err := outputOpt.validate(); err != nil {
+		return err
+	}
+
+	conn, err := getConn(os.Getenv("CLICKHOUSE_URL"))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	for i := range scenario.Phases {
+		if write := scenario.Phases[i].Write; write != nil {
+			if err := write.opt.loadTable(conn); err != nil {
+				return fmt.Errorf("phase %s: %v", scenario.Phases[i].Name, err)
+			}
+		}
+	}
+
+	// All phases share one clock so the offsets line up across the report
+	clock := time.Now()
+	document := newResult(cmd, conn, clock)
+	results := make([]phaseResult, 0, len(scenario.Phases))
+	sampler := startServerSampler(conn, clock)
+
+	for i := range scenario.Phases {
+		phase := &scenario.Phases[i]
+		result := phaseResult{phase: phase, offset: time.Since(clock)}
+		show.Info("Phase %d/%d %s (%s) started at T+%v for %v", i+1, len(scenario.Phases), phase.Name, phase.Kind, result.offset.Round(time.Second), phase.Duration)
+
+		ctx, cancel := context.WithTimeout(context.Background(), phase.Duration)
+		wg := sync.WaitGroup{}
+
+		if phase.Write != nil {
+			opt := phase.Write.opt
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				result.write = runWrite(ctx, conn, &opt)
+			}()
+		}
+
+		if phase.Read != nil {
+			read := phase.Read
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				limiter := newPacer(read.Rate)
+				if read.RateTo > 0 {
+					go limiter.Ramp(ctx, read.Rate, read.RateTo, phase.Duration)
+				}
+				tasks := scheduleWindowReads(ctx, read.workload, read.Window, limiter)
+				result.read = runReadTasks(conn, read.workload, read.Concurrency, scenario.ReportInterval, tasks)
+			}()
+		}
+
+		wg.Wait()
+		cancel()
+		result.elapsed = time.Since(clock) - result.offset
+		results = append(results, result)
+	}
+	sampler.Stop()
+
+	printScenarioResults(time.Since(clock), results)
+	sampler.print()
+
+	addScenarioResults(document, results)
+	sampler.addTo(document)
+	captureServerStats(conn, document)
+	return publishResult(conn, document)
+}
+
+// scheduleWindowReads keeps picking workload queries over the latest window until ctx is done
+func scheduleWindowReads(ctx context.Context, workload *Workload, window time.Duration, limiter *pacer) <-chan readTask {
+	tasks := make(chan readTask)
+	go func() {
+		defer close(tasks)
+		r := rand.New(rand.NewSource(time.Now().UnixNano()))
+		for bucket := 1; ; bucket++ {
+			if _, err := limiter.Wait(ctx, 1); err != nil {
+				return
+			}
+
+			end := time.Now()
+			query := workload.pick(r)
+			task := readTask{bucket: bucket, name: query.Name, query: query.render(end.Add(-window), end, window), settings: query.settings}
+			select {
+			case tasks <- task:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return tasks
+}
+
+func printScenarioResults(elapsed time.Duration, results []phaseResult) {
+	show.EmptyLine()
+	show.Info("ClickHouse URL: %s", os.Getenv("CLICKHOUSE_URL"))
+	show.Info("Scenario: %s", runOpt.scenario)
+	show.Info("Time taken for tests: %v", elapsed)
+
+	for i, result := range results {
+		phase := result.phase
+		show.EmptyLine()
+		show.Info("Phase %d %s (%s): T+%v .. T+%v", i+1, phase.Name, phase.Kind,
+			result.offset.Round(time.Second), (result.offset + result.elapsed).Round(time.Second))
+
+		if w := result.write; w != nil {
+			summary := w.latency.Summary()
+			show.Info("  write: rows: %d, %.0f rows/s, %s, inserts: %d, failed: %d, dropped rows: %d, insert p50: %.2f ms, p99: %.2f ms",
+				w.rows, w.rowsPerSecond(), requestedRate(float64(phase.Write.Rate), float64(phase.Write.RateTo), "rows/s"),
+				w.inserts, w.failedInserts, w.dropped, summary.P50, summary.P99)
+		}
+
+		if r := result.read; r != nil {
+			summary := r.latency.Summary()
+			show.Info("  read: queries: %d, %.2f qps, %s, failed: %d, p50: %.2f ms, p99: %.2f ms, p999: %.2f ms",
+				r.executed, r.queriesPerSecond(), requestedRate(phase.Read.Rate, phase.Read.RateTo, "qps"),
+				r.failed, summary.P50, summary.P99, summary.P999)
+			for _, query := range r.queries {
+				if len(r.queries) == 1 {
+					break
+				}
+				stat := r.mix[query.Name]
+				querySummary := stat.latency.Summary()
+				show.Info("    query %s: executed: %d, failed: %d, p50: %.2f ms, p99: %.2f ms",
+					query.Name, querySummary.Count+stat.failed, stat.failed, querySummary.P50, querySummary.P99)
+			}
+		}
+	}
+}
+
+// addScenarioResults adds every phase to the result document, the metric names start with the phase name
+func addScenarioResults(document *report.Result, results []phaseResult) {
+	table := report.Table{Name: "phases", Columns: []string{"phase", "kind", "offset_seconds", "duration_seconds", "elapsed_seconds"}}
+	for _, result := range results {
+		phase := result.phase
+		table.Rows = append(table.Rows, []string{
+			phase.Name,
+			phase.Kind,
+			strconv.FormatFloat(result.offset.Seconds(), 'f', 3, 64),
+			strconv.FormatFloat(phase.Duration.Seconds(), 'f', 3, 64),
+			strconv.FormatFloat(result.elapsed.Seconds(), 'f', 3, 64),
+		})
+
+		if result.write != nil {
+			result.write.addTo(document, phase.Name+".", document.StartedAt)
+		}
+		if result.read != nil {
+			result.read.addTo(document, phase.Name+".", document.StartedAt)
+		}
+	}
+	document.Tables = append([]report.Table{table}, document.Tables...)
+}
+
+func requestedRate(rate, rateTo float64, unit string) string {
+	switch {
+	case rate == 0:
+		return "requested: unlimited"
+	case rateTo > 0:
+		return fmt.Sprintf("requested: %.0f to %.0f %s", rate, rateTo, unit)
+	default:
+		return fmt.Sprintf("requested: %.0f %s", rate, unit)
+	}
+}
@@ -0,0 +1,263 @@
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"clickhouse-benchmark/pkg/report"
+	"clickhouse-benchmark/pkg/show"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/spf13/cobra"
+)
+
+// Server wide gauges of system.metrics
+var sampledMetrics = []string{
+	"Query", "Merge", "PartMutation", "MemoryTracking", "DelayedInserts",
+	"PendingAsyncInsert", "BackgroundMergesAndMutationsPoolTask", "TCPConnection", "HTTPConnection",
+}
+
+// Gauges of system.asynchronous_metrics, refreshed by the server every second
+var sampledAsynchronousMetrics = []string{
+	"MaxPartCountForPartition", "TotalPartsOfMergeTreeTables", "MemoryResident",
+	"LoadAverage1", "OSUserTimeNormalized", "OSSystemTimeNormalized", "OSIOWaitTimeNormalized",
+}
+
+// Counters of system.events, sampled as per second rates
+var sampledEvents = []string{
+	"Query", "InsertQuery", "SelectQuery", "InsertedRows", "InsertedBytes", "SelectedRows",
+	"MergedRows", "DelayedInserts", "RejectedInserts", "OSCPUVirtualTimeMicroseconds",
+	"UserTimeMicroseconds", "SystemTimeMicroseconds",
+}
+
+var sampleInterval time.Duration
+
+func addSamplerFlag(cmd *cobra.Command) {
+	cmd.Flags().DurationVar(&sampleInterval, "sample-interval", 0, "poll system.metrics, system.asynchronous_metrics and system.events at this interval like 5s, 0 disables")
+}
+
+// serverSample is one poll of the three tables
+type serverSample struct {
+	time                time.Time
+	metrics             []float64
+	asynchronousMetrics []float64
+	events              []float64 // counters, turned into rates by the sampler
+}
+
+// serverSampler polls the server wide metrics during a run to show why the
+// latency changed, not only that it did
+type serverSampler struct {
+	conn     driver.Conn
+	interval time.Duration
+	clock    time.Time
+
+	mu      sync.Mutex
+	samples []serverSample
+	last    *serverSample // previous counters of the event rates
+	failed  int
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// startServerSampler starts polling when --sample-interval is set, clock is
+// the start of the run the offsets of the series refer to
+func startServerSampler(conn driver.Conn, clock time.Time) *serverSampler {
+	if sampleInterval <= 0 || debugFlag {
+		return nil
+	}
+	s := &serverSampler{
+		conn:     conn,
+		interval: sampleInterval,
+		clock:    clock,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	show.Info("Sampling server metrics every %v", s.interval)
+	go func() {
+		defer close(s.done)
+		s.sample()
+
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.sample()
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+	return s
+}
+
+// Stop ends the polling, a nil sampler was never started
+func (s *serverSampler) Stop() {
+	if s == nil {
+		return
+	}
+	close(s.stop)
+	<-s.done
+	s.sample()
+}
+
+func (s *serverSampler) sample() {
+	sample, err := s.poll()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.failed++
+		if s.failed == 1 {
+			show.Warn("failed to sample the server metrics: %v", err)
+		}
+		return
+	}
+
+	counters := sample.events
+	if s.last != nil {
+		rates := make([]float64, len(counters))
+		seconds := sample.time.Sub(s.last.time).Seconds()
+		for i := range counters {
+			if seconds > 0 && counters[i] >= s.last.events[i] {
+				rates[i] = (counters[i] - s.last.events[i]) / seconds
+			}
+		}
+		sample.events = rates
+		s.samples = append(s.samples, sample)
+	}
+	s.last = &serverSample{time: sample.time, events: counters}
+}
+
+func (s *serverSampler) poll() (serverSample, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.interval)
+	defer cancel()
+
+	sample := serverSample{time: time.Now()}
+	var err error
+	if sample.metrics, err = s.query(ctx, "SELECT metric, toFloat64(value) FROM system.metrics WHERE metric IN (%s)", sampledMetrics); err != nil {
+		return sample, err
+	}
+	if sample.asynchronousMetrics, err = s.query(ctx, "SELECT metric, toFloat64(value) FROM system.asynchronous_metrics WHERE metric IN (%s)", sampledAsynchronousMetrics); err != nil {
+		return sample, err
+	}
+	if sample.events, err = s.query(ctx, "SELECT event, toFloat64(value) FROM system.events WHERE event IN (%s)", sampledEvents); err != nil {
+		return sample, err
+	}
+	return sample, nil
+}
+
+// query reads name and value pairs in the order of names, names the server
+// does not know stay 0
+func (s *serverSampler) query(ctx context.Context, query string, names []string) ([]float64, error) {
+	quoted := make([]string, len(names))
+	index := make(map[string]int, len(names))
+	for i, name := range names {
+		quoted[i] = "'" + name + "'"
+		index[name] = i
+	}
+
+	rows, err := s.conn.Query(withQueryID(ctx, "sample"), fmt.Sprintf(query, strings.Join(quoted, ", ")))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := make([]float64, len(names))
+	for rows.Next() {
+		var (
+			name  string
+			value float64
+		)
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, err
+		}
+		if i, ok := index[name]; ok {
+			values[i] = value
+		}
+	}
+	return values, rows.Err()
+}
+
+// print shows the peak of every sampled value
+func (s *serverSampler) print() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.samples) == 0 {
+		return
+	}
+
+	show.EmptyLine()
+	show.Info("Server metrics: %d samples every %v, %d failed", len(s.samples), s.interval, s.failed)
+	show.Info("Peak metrics: %s", peaks(sampledMetrics, s.samples, func(sample serverSample) []float64 { return sample.metrics }))
+	show.Info("Peak asynchronous metrics: %s", peaks(sampledAsynchronousMetrics, s.samples, func(sample serverSample) []float64 { return sample.asynchronousMetrics }))
+	show.Info("Peak events per second: %s", peaks(sampledEvents, s.samples, func(sample serverSample) []float64 { return sample.events }))
+}
+
+func peaks(names []string, samples []serverSample, values func(serverSample) []float64) string {
+	peak := make([]float64, len(names))
+	for _, sample := range samples {
+		for i, value := range values(sample) {
+			if value > peak[i] {
+				peak[i] = value
+			}
+		}
+	}
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s: %.2f", name, peak[i])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// addTo embeds the samples as the series server_metrics,
+// server_asynchronous_metrics and server_events_per_second
+func (s *serverSampler) addTo(result *report.Result) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.samples) == 0 {
+		return
+	}
+
+	metrics := report.Series{Name: "server_metrics", Fields: sampledMetrics}
+	asynchronousMetrics := report.Series{Name: "server_asynchronous_metrics", Fields: sampledAsynchronousMetrics}
+	events := report.Series{Name: "server_events_per_second", Fields: sampledEvents}
+	for _, sample := range s.samples {
+		point := report.Point{Time: sample.time, Offset: sample.time.Sub(s.clock).Seconds()}
+		point.Values = sample.metrics
+		metrics.Points = append(metrics.Points, point)
+		point.Values = sample.asynchronousMetrics
+		asynchronousMetrics.Points = append(asynchronousMetrics.Points, point)
+		point.Values = sample.events
+		events.Points = append(events.Points, point)
+	}
+	result.Series = append(result.Series, metrics, asynchronousMetrics, events)
+}
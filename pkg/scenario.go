@@ -0,0 +1,224 @@
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	phaseWarmup   = "warmup"
+	phaseRamp     = "ramp"
+	phaseSteady   = "steady"
+	phaseCooldown = "cooldown"
+)
+
+// Scenario is a sequence of phases that run mixed read and write workloads
+type Scenario struct {
+	ReportInterval time.Duration `yaml:"report_interval"`
+	Phases         []Phase       `yaml:"phases"`
+}
+
+// Phase runs its writer and reader side by side for the duration
+type Phase struct {
+	Name     string        `yaml:"name"`
+	Kind     string        `yaml:"kind"`
+	Duration time.Duration `yaml:"duration"`
+	Write    *PhaseWrite   `yaml:"write"`
+	Read     *PhaseRead    `yaml:"read"`
+}
+
+// PhaseWrite mirrors the flags of the write command
+type PhaseWrite struct {
+	Concurrency   int               `yaml:"concurrency"`
+	Size          int               `yaml:"size"`
+	Rate          int               `yaml:"rate"`
+	RateTo        int               `yaml:"rate_to"`
+	Loop          string            `yaml:"loop"`
+	Random        bool              `yaml:"random"`
+	FlushRows     int               `yaml:"flush_rows"`
+	FlushBytes    int               `yaml:"flush_bytes"`
+	FlushInterval time.Duration     `yaml:"flush_interval"`
+	Generator     string            `yaml:"generator"`
+	Series        SeriesSpec        `yaml:"series"`
+	Timestamps    TimestampSpec     `yaml:"timestamps"`
+	Table         string            `yaml:"table"`
+	Append        string            `yaml:"append"`
+	AsyncInsert   string            `yaml:"async_insert"`
+	Settings      map[string]string `yaml:"settings"`
+
+	opt WriteOption
+}
+
+// PhaseRead queries the latest window of data, {start} and {end} are now - window and now
+type PhaseRead struct {
+	Concurrency int               `yaml:"concurrency"`
+	Rate        float64           `yaml:"rate"` // queries per second, 0 means back to back
+	RateTo      float64           `yaml:"rate_to"`
+	Window      time.Duration     `yaml:"window"`
+	Workload    string            `yaml:"workload"`
+	SQL         string            `yaml:"sql"`
+	Settings    map[string]string `yaml:"settings"`
+
+	workload *Workload
+}
+
+func loadScenario(path string) (*Scenario, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scenario file: %v", err)
+	}
+
+	scenario := &Scenario{ReportInterval: 10 * time.Second}
+	if err := yaml.Unmarshal(content, scenario); err != nil {
+		return nil, fmt.Errorf("failed to parse scenario file: %v", err)
+	}
+
+	if err := scenario.validate(); err != nil {
+		return nil, err
+	}
+	return scenario, nil
+}
+
+func (s *Scenario) validate() error {
+	if len(s.Phases) == 0 {
+		return fmt.Errorf("scenario has no phases")
+	}
+
+	for i := range s.Phases {
+		phase := &s.Phases[i]
+		if phase.Name == "" {
+			phase.Name = phase.Kind
+		}
+		if err := phase.validate(s.ReportInterval); err != nil {
+			return fmt.Errorf("phase %d %s: %v", i+1, phase.Name, err)
+		}
+	}
+	return nil
+}
+
+func (p *Phase) validate(reportInterval time.Duration) error {
+	switch p.Kind {
+	case phaseWarmup, phaseRamp, phaseSteady, phaseCooldown:
+	default:
+		return fmt.Errorf("invalid kind: %q", p.Kind)
+	}
+	if p.Duration <= 0 {
+		return fmt.Errorf("duration must be positive")
+	}
+	if p.Write == nil && p.Read == nil {
+		return fmt.Errorf("phase has neither write nor read settings")
+	}
+	if p.Kind == phaseRamp && (p.Write == nil || p.Write.RateTo == 0) && (p.Read == nil || p.Read.RateTo == 0) {
+		return fmt.Errorf("ramp phase needs a rate_to")
+	}
+
+	if p.Write != nil {
+		p.Write.opt = p.Write.option(p.Duration, reportInterval)
+		if err := p.Write.opt.validate(); err != nil {
+			return fmt.Errorf("write: %v", err)
+		}
+	}
+
+	if p.Read != nil {
+		if err := p.Read.validate(); err != nil {
+			return fmt.Errorf("read: %v", err)
+		}
+	}
+	return nil
+}
+
+// option turns the phase settings into write options, unset values get the write command defaults
+func (w *PhaseWrite) option(duration, reportInterval time.Duration) WriteOption {
+	opt := WriteOption{
+		size:             w.Size,
+		concurrencyLimit: w.Concurrency,
+		randomColumn:     w.Random,
+		duration:         duration,
+		rate:             w.Rate,
+		rateTo:           w.RateTo,
+		loop:             w.Loop,
+		reportInterval:   reportInterval,
+		flushRows:        w.FlushRows,
+		flushBytes:       w.FlushBytes,
+		flushInterval:    w.FlushInterval,
+		generator:        w.Generator,
+		series:           w.Series,
+		timestamps:       w.Timestamps,
+		table:            w.Table,
+		appendMode:       w.Append,
+		asyncInsert:      w.AsyncInsert,
+		querySettings:    settingsOf(w.Settings),
+	}
+	if opt.size == 0 {
+		opt.size = 1
+	}
+	if opt.concurrencyLimit == 0 {
+		opt.concurrencyLimit = 1
+	}
+	if opt.loop == "" {
+		opt.loop = closedLoop
+	}
+	if opt.appendMode == "" {
+		opt.appendMode = structAppend
+	}
+	if opt.asyncInsert == "" {
+		opt.asyncInsert = asyncInsertOff
+	}
+	return opt
+}
+
+func (r *PhaseRead) validate() error {
+	if r.Concurrency == 0 {
+		r.Concurrency = 1
+	}
+	if r.Window == 0 {
+		r.Window = time.Minute
+	}
+	if r.Concurrency < 0 || r.Window < 0 || r.Rate < 0 || r.RateTo < 0 {
+		return fmt.Errorf("concurrency, window and rates must not be negative")
+	}
+	if r.RateTo > 0 && r.Rate == 0 {
+		return fmt.Errorf("rate_to requires a rate")
+	}
+
+	switch {
+	case r.Workload != "" && r.SQL != "":
+		return fmt.Errorf("workload and sql are mutually exclusive")
+	case r.Workload != "":
+		workload, err := loadWorkload(r.Workload)
+		if err != nil {
+			return err
+		}
+		r.workload = workload
+	case r.SQL != "":
+		r.workload = &Workload{Queries: []WorkloadQuery{{Name: "default", Weight: 1, SQL: r.SQL}}}
+		if err := r.workload.validate(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("either workload or sql is required")
+	}
+	r.workload.applySettings(settingsOf(r.Settings))
+	return nil
+}
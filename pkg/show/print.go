@@ -2,8 +2,18 @@ package show
 
 import (
 	"fmt"
+	"io"
+	"os"
 )
 
+// output is where the log lines go
+var output io.Writer = os.Stdout
+
+// SetOutput redirects the log lines, for example to keep stdout free for a result document
+func SetOutput(w io.Writer) {
+	output = w
+}
+
 // Define ANSI escape code colors
 const (
 	ResetColor = "\033[0m"
@@ -24,7 +34,7 @@ const (
 // Output log with color and icon
 func logWithColor(level, color, icon, format string, a ...interface{}) {
 	message := fmt.Sprintf(format, a...)
-	fmt.Printf("%s%s %s%s %s\n", color, icon, level, ResetColor, message)
+	fmt.Fprintf(output, "%s%s %s%s %s\n", color, icon, level, ResetColor, message)
 }
 
 // Debug outputs debug information
@@ -48,5 +58,5 @@ func Error(format string, a ...interface{}) {
 }
 
 func EmptyLine() {
-	fmt.Println()
+	fmt.Fprintln(output)
 }
@@ -0,0 +1,316 @@
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"clickhouse-benchmark/pkg/generator"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MetricSpec describes how the columns of the generated metrics are distributed
+type MetricSpec struct {
+	Seed         int64                  `yaml:"seed" json:"seed"` // 0 picks a random seed
+	MetricGroup  generator.Distribution `yaml:"metric_group" json:"metric_group"`
+	NumberFields FieldSpec              `yaml:"number_fields" json:"number_fields"`
+	StringFields FieldSpec              `yaml:"string_fields" json:"string_fields"`
+	Tags         FieldSpec              `yaml:"tags" json:"tags"`
+	Series       *SeriesSpec            `yaml:"series" json:"series"` // replaces metric_group and tags when set
+}
+
+// SeriesSpec is a fixed population of series that the rows cycle through. A
+// series is a metric group, a tag key set and a combination of tag values.
+type SeriesSpec struct {
+	Count        int64 `yaml:"count" json:"count"`
+	MetricGroups int64 `yaml:"metric_groups" json:"metric_groups"`
+	TagKeySets   int64 `yaml:"tag_key_sets" json:"tag_key_sets"`
+	Tags         int   `yaml:"tags" json:"tags"` // tags per series
+
+	valuesPerTag int64
+	next         int64
+}
+
+// FieldSpec describes a pair of key and value arrays
+type FieldSpec struct {
+	Count  generator.Distribution `yaml:"count" json:"count"`   // array length
+	Keys   generator.Distribution `yaml:"keys" json:"keys"`     // the cardinality is the number of distinct keys
+	Values generator.Distribution `yaml:"values" json:"values"` // value of every key
+}
+
+// seedOffset keeps the generators of concurrent workers apart
+var seedOffset int64
+
+// defaultMetricSpec mirrors the constant metric of generateMetric
+func defaultMetricSpec() *MetricSpec {
+	return &MetricSpec{
+		MetricGroup: generator.Constant("sample_metric_group"),
+		NumberFields: FieldSpec{
+			Count:  generator.Constant("2"),
+			Keys:   generator.Distribution{Type: generator.Sequential, Cardinality: 2, Prefix: "number_field_key_"},
+			Values: generator.Distribution{Type: generator.Enum, Values: []string{"1.23", "4.56"}},
+		},
+		StringFields: FieldSpec{
+			Count:  generator.Constant("2"),
+			Keys:   generator.Distribution{Type: generator.Sequential, Cardinality: 2, Prefix: "string_field_key_"},
+			Values: generator.Distribution{Type: generator.Enum, Values: []string{"value1", "value2"}},
+		},
+		Tags: FieldSpec{
+			Count:  generator.Constant("2"),
+			Keys:   generator.Distribution{Type: generator.Sequential, Cardinality: 2, Prefix: "tag_key_"},
+			Values: generator.Distribution{Type: generator.Uniform, Cardinality: 2, Prefix: "tag_value_"},
+		},
+	}
+}
+
+// loadMetricSpec reads a generator spec, JSON when the extension is .json and YAML otherwise.
+// Sections missing from the file keep the defaults.
+func loadMetricSpec(path string) (*MetricSpec, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read generator spec: %v", err)
+	}
+
+	spec := defaultMetricSpec()
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(content, spec)
+	} else {
+		err = yaml.Unmarshal(content, spec)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse generator spec: %v", err)
+	}
+
+	if err := spec.validate(); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+func (s *MetricSpec) validate() error {
+	if err := s.MetricGroup.Validate(); err != nil {
+		return fmt.Errorf("metric_group: %v", err)
+	}
+	if err := s.NumberFields.validate(true); err != nil {
+		return fmt.Errorf("number_fields: %v", err)
+	}
+	if err := s.StringFields.validate(false); err != nil {
+		return fmt.Errorf("string_fields: %v", err)
+	}
+	if err := s.Tags.validate(false); err != nil {
+		return fmt.Errorf("tags: %v", err)
+	}
+	if s.Series != nil {
+		if err := s.Series.validate(); err != nil {
+			return fmt.Errorf("series: %v", err)
+		}
+	}
+	return nil
+}
+
+func (s *SeriesSpec) validate() error {
+	if s.MetricGroups == 0 {
+		s.MetricGroups = 1
+	}
+	if s.TagKeySets == 0 {
+		s.TagKeySets = 1
+	}
+	if s.Tags == 0 {
+		s.Tags = 2
+	}
+	if s.Count <= 0 || s.MetricGroups < 0 || s.TagKeySets < 0 || s.Tags < 0 {
+		return fmt.Errorf("count, metric groups, tag key sets and tags must be positive")
+	}
+	if s.MetricGroups*s.TagKeySets > s.Count {
+		return fmt.Errorf("%d metric groups times %d tag key sets exceed %d series", s.MetricGroups, s.TagKeySets, s.Count)
+	}
+
+	// Spread the value combinations evenly over the tags so that every series gets its own one
+	combinations := (s.Count + s.MetricGroups*s.TagKeySets - 1) / (s.MetricGroups * s.TagKeySets)
+	s.valuesPerTag = int64(math.Ceil(math.Pow(float64(combinations), 1/float64(s.Tags))))
+	for s.pow(s.valuesPerTag, s.Tags) < combinations {
+		s.valuesPerTag++
+	}
+	return nil
+}
+
+func (s *SeriesSpec) pow(base int64, exponent int) int64 {
+	result := int64(1)
+	for i := 0; i < exponent; i++ {
+		result *= base
+	}
+	return result
+}
+
+// nextSeries returns the index of the next series, all workers share the cycle
+func (s *SeriesSpec) nextSeries() int64 {
+	return (atomic.AddInt64(&s.next, 1) - 1) % s.Count
+}
+
+// series derives the metric group, tag keys and tag values of the index-th series
+func (s *SeriesSpec) series(index int64) (string, []string, []string) {
+	group := index % s.MetricGroups
+	keySet := (index / s.MetricGroups) % s.TagKeySets
+	combination := index / (s.MetricGroups * s.TagKeySets)
+
+	keys := make([]string, s.Tags)
+	values := make([]string, s.Tags)
+	for j := range keys {
+		keys[j] = fmt.Sprintf("tag_key_%d_%d", keySet, j)
+		values[j] = fmt.Sprintf("tag_value_%d", combination%s.valuesPerTag)
+		combination /= s.valuesPerTag
+	}
+	return fmt.Sprintf("metric_group_%d", group), keys, values
+}
+
+func (f *FieldSpec) validate(numeric bool) error {
+	if err := f.Count.ValidateNumber(); err != nil {
+		return fmt.Errorf("count: %v", err)
+	}
+	if err := f.Keys.Validate(); err != nil {
+		return fmt.Errorf("keys: %v", err)
+	}
+	if f.Keys.Type != generator.Enum && f.Keys.Cardinality == 0 {
+		return fmt.Errorf("keys: cardinality is required")
+	}
+
+	validateValues := f.Values.Validate
+	if numeric {
+		validateValues = f.Values.ValidateNumber
+	}
+	if err := validateValues(); err != nil {
+		return fmt.Errorf("values: %v", err)
+	}
+	return nil
+}
+
+// keyCardinality is the number of distinct keys a row can hold
+func (f *FieldSpec) keyCardinality() int {
+	if f.Keys.Type == generator.Enum {
+		return len(f.Keys.Values)
+	}
+	return f.Keys.Cardinality
+}
+
+// metricGenerator draws metrics from a spec, every worker owns one
+type metricGenerator struct {
+	series       *SeriesSpec
+	group        *generator.Sampler
+	numberFields *fieldSampler
+	stringFields *fieldSampler
+	tags         *fieldSampler
+}
+
+type fieldSampler struct {
+	spec   *FieldSpec
+	count  *generator.Sampler
+	keys   *generator.Sampler
+	values *generator.Sampler
+	prefix string
+}
+
+func newMetricGenerator(spec *MetricSpec) *metricGenerator {
+	seed := spec.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	r := rand.New(rand.NewSource(seed + atomic.AddInt64(&seedOffset, 1)))
+
+	return &metricGenerator{
+		series:       spec.Series,
+		group:        spec.MetricGroup.NewSampler(r),
+		numberFields: newFieldSampler(&spec.NumberFields, r, "number_field_key_"),
+		stringFields: newFieldSampler(&spec.StringFields, r, "string_field_key_"),
+		tags:         newFieldSampler(&spec.Tags, r, "tag_key_"),
+	}
+}
+
+func newFieldSampler(spec *FieldSpec, r *rand.Rand, prefix string) *fieldSampler {
+	return &fieldSampler{
+		spec:   spec,
+		count:  spec.Count.NewSampler(r),
+		keys:   spec.Keys.NewSampler(r),
+		values: spec.Values.NewSampler(r),
+		prefix: prefix,
+	}
+}
+
+// Generate draws one metric with the given timestamp
+func (g *metricGenerator) Generate(timestamp time.Time) Metric {
+	metric := Metric{
+		Timestamp:   timestamp,
+		MetricGroup: g.group.String("metric_group_"),
+	}
+
+	metric.NumberFieldKeys = g.numberFields.drawKeys()
+	metric.NumberFieldValues = make([]float64, len(metric.NumberFieldKeys))
+	for i := range metric.NumberFieldValues {
+		metric.NumberFieldValues[i] = g.numberFields.values.Float64()
+	}
+
+	metric.StringFieldKeys = g.stringFields.drawKeys()
+	metric.StringFieldValues = g.stringFields.drawValues(len(metric.StringFieldKeys), "string_value_")
+
+	if g.series != nil {
+		metric.MetricGroup, metric.TagKeys, metric.TagValues = g.series.series(g.series.nextSeries())
+		return metric
+	}
+
+	metric.TagKeys = g.tags.drawKeys()
+	metric.TagValues = g.tags.drawValues(len(metric.TagKeys), "tag_value_")
+
+	return metric
+}
+
+// drawKeys draws distinct keys, never more than the key cardinality
+func (f *fieldSampler) drawKeys() []string {
+	count := f.count.Int()
+	if cardinality := f.spec.keyCardinality(); count > cardinality {
+		count = cardinality
+	}
+
+	keys := make([]string, 0, count)
+	seen := make(map[string]bool, count)
+	// Skewed key distributions may take a while to hit unseen keys, give up instead of spinning
+	for attempts := 0; len(keys) < count && attempts < count*10; attempts++ {
+		key := f.keys.String(f.prefix)
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func (f *fieldSampler) drawValues(count int, prefix string) []string {
+	values := make([]string, count)
+	for i := range values {
+		values[i] = f.values.String(prefix)
+	}
+	return values
+}
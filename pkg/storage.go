@@ -0,0 +1,202 @@
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"clickhouse-benchmark/pkg/report"
+	"clickhouse-benchmark/pkg/show"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+// columnStorage is what one column costs in the active parts
+type columnStorage struct {
+	name         string
+	typ          string
+	codec        string // empty for the default codec of the server
+	compressed   uint64
+	uncompressed uint64
+	marks        uint64
+}
+
+// tableStorage breaks the size of the table down by column
+type tableStorage struct {
+	rows         uint64
+	bytesOnDisk  uint64
+	parts        uint64
+	compactParts uint64
+	compact      columnStorage   // sizes of the compact parts, not attributed to columns
+	columns      []columnStorage // sizes of the wide parts, largest compressed first
+}
+
+// getTableStorage reads the codecs from system.columns and the sizes of the
+// active parts from system.parts_columns, both of the local replica. Compact
+// parts keep all columns in one file and have no column sizes, their sizes
+// come from system.parts as one unattributed row.
+func getTableStorage(conn driver.Conn) (*tableStorage, error) {
+	ctx := context.Background()
+	storage := &tableStorage{compact: columnStorage{name: "(compact parts)"}}
+	query := fmt.Sprintf(`SELECT toUInt64(sum(rows)), toUInt64(sum(bytes_on_disk)), toUInt64(count()), toUInt64(countIf(part_type = 'Compact')),
+			toUInt64(sumIf(data_compressed_bytes, part_type = 'Compact')), toUInt64(sumIf(data_uncompressed_bytes, part_type = 'Compact')),
+			toUInt64(sumIf(marks_bytes, part_type = 'Compact'))
+		FROM system.parts WHERE active AND database = '%s' AND table = '%s'`, databaseName, tableName)
+	if err := conn.QueryRow(ctx, query).Scan(&storage.rows, &storage.bytesOnDisk, &storage.parts, &storage.compactParts,
+		&storage.compact.compressed, &storage.compact.uncompressed, &storage.compact.marks); err != nil {
+		return nil, err
+	}
+
+	query = fmt.Sprintf("SELECT name, type, compression_codec FROM system.columns WHERE database = '%s' AND table = '%s' ORDER BY position", databaseName, tableName)
+	rows, err := conn.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	index := make(map[string]int)
+	for rows.Next() {
+		var column columnStorage
+		if err := rows.Scan(&column.name, &column.typ, &column.codec); err != nil {
+			return nil, err
+		}
+		index[column.name] = len(storage.columns)
+		storage.columns = append(storage.columns, column)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query = fmt.Sprintf(`SELECT column, toUInt64(sum(column_data_compressed_bytes)), toUInt64(sum(column_data_uncompressed_bytes)), toUInt64(sum(column_marks_bytes))
+		FROM system.parts_columns WHERE active AND part_type = 'Wide' AND database = '%s' AND table = '%s' GROUP BY column`, databaseName, tableName)
+	sizes, err := conn.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer sizes.Close()
+	for sizes.Next() {
+		var (
+			name                            string
+			compressed, uncompressed, marks uint64
+		)
+		if err := sizes.Scan(&name, &compressed, &uncompressed, &marks); err != nil {
+			return nil, err
+		}
+		if i, ok := index[name]; ok {
+			storage.columns[i].compressed = compressed
+			storage.columns[i].uncompressed = uncompressed
+			storage.columns[i].marks = marks
+		}
+	}
+	if err := sizes.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(storage.columns, func(i, j int) bool { return storage.columns[i].compressed > storage.columns[j].compressed })
+	return storage, nil
+}
+
+func (c columnStorage) ratio() float64 {
+	if c.compressed == 0 {
+		return 0
+	}
+	return float64(c.uncompressed) / float64(c.compressed)
+}
+
+func (c columnStorage) codecName() string {
+	if c.codec == "" {
+		return "default"
+	}
+	return c.codec
+}
+
+// perRow divides bytes by the rows of the table
+func (s *tableStorage) perRow(bytes uint64) float64 {
+	if s.rows == 0 {
+		return 0
+	}
+	return float64(bytes) / float64(s.rows)
+}
+
+func (s *tableStorage) totals() (compressed, uncompressed, marks uint64) {
+	compressed, uncompressed, marks = s.compact.compressed, s.compact.uncompressed, s.compact.marks
+	for _, column := range s.columns {
+		compressed += column.compressed
+		uncompressed += column.uncompressed
+		marks += column.marks
+	}
+	return compressed, uncompressed, marks
+}
+
+func (s *tableStorage) print() {
+	show.Info("Columns:")
+	for _, column := range s.columns {
+		show.Info("Column %s %s, codec: %s, compressed: %.2f MB, uncompressed: %.2f MB, ratio: %.2f, marks: %.2f MB, bytes/row: %.2f",
+			column.name, column.typ, column.codecName(), float64(column.compressed)/1024/1024, float64(column.uncompressed)/1024/1024,
+			column.ratio(), float64(column.marks)/1024/1024, s.perRow(column.compressed))
+	}
+	if s.compactParts > 0 {
+		show.Warn("%d of %d active parts are compact and have no column sizes, the columns above cover the wide parts only", s.compactParts, s.parts)
+		show.Info("Compact parts: compressed: %.2f MB, uncompressed: %.2f MB, ratio: %.2f, marks: %.2f MB, bytes/row: %.2f",
+			float64(s.compact.compressed)/1024/1024, float64(s.compact.uncompressed)/1024/1024,
+			s.compact.ratio(), float64(s.compact.marks)/1024/1024, s.perRow(s.compact.compressed))
+	}
+
+	compressed, uncompressed, _ := s.totals()
+	show.Info("Table rows: %d, bytes/row on disk: %.2f, compressed: %.2f, uncompressed: %.2f",
+		s.rows, s.perRow(s.bytesOnDisk), s.perRow(compressed), s.perRow(uncompressed))
+	show.EmptyLine()
+}
+
+// addTo adds the columns table and the per row costs
+func (s *tableStorage) addTo(document *report.Result) {
+	table := report.Table{
+		Name:    "columns",
+		Columns: []string{"column", "type", "codec", "compressed_bytes", "uncompressed_bytes", "compression_ratio", "marks_bytes", "compressed_bytes_per_row"},
+	}
+	columns := s.columns
+	if s.compactParts > 0 {
+		columns = append(columns[:len(columns):len(columns)], s.compact)
+	}
+	for _, column := range columns {
+		table.Rows = append(table.Rows, []string{
+			column.name,
+			column.typ,
+			column.codecName(),
+			strconv.FormatUint(column.compressed, 10),
+			strconv.FormatUint(column.uncompressed, 10),
+			strconv.FormatFloat(column.ratio(), 'f', 3, 64),
+			strconv.FormatUint(column.marks, 10),
+			strconv.FormatFloat(s.perRow(column.compressed), 'f', 3, 64),
+		})
+	}
+	document.Tables = append(document.Tables, table)
+
+	compressed, uncompressed, marks := s.totals()
+	document.AddMetric("bytes_per_row", s.perRow(s.bytesOnDisk), "bytes", false)
+	document.AddMetric("compressed_bytes_per_row", s.perRow(compressed), "bytes", false)
+	document.AddMetric("uncompressed_bytes_per_row", s.perRow(uncompressed), "bytes", false)
+	document.AddMetric("marks_bytes", float64(marks), "bytes", false)
+	document.AddMetric("compact_parts", float64(s.compactParts), "parts", false)
+	if compressed > 0 {
+		document.AddMetric("compression_ratio", float64(uncompressed)/float64(compressed), "ratio", true)
+	}
+}
@@ -0,0 +1,113 @@
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"clickhouse-benchmark/pkg/generator"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+// targetTable is a table introspected from system.columns that rows are generated for
+type targetTable struct {
+	database string
+	table    string
+	columns  []tableColumn
+}
+
+type tableColumn struct {
+	name string
+	typ  *generator.ColumnType
+}
+
+// parseTableName splits db.table, a bare table lives in the default database
+func parseTableName(name string) (string, string, error) {
+	database, table := databaseName, name
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		database, table = name[:i], name[i+1:]
+	}
+	if database == "" || table == "" {
+		return "", "", fmt.Errorf("invalid table: %s", name)
+	}
+	return database, table, nil
+}
+
+// loadTargetTable reads the insertable columns of a table, materialized,
+// alias and ephemeral columns are computed by the server
+func loadTargetTable(conn driver.Conn, name string) (*targetTable, error) {
+	database, table, err := parseTableName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	query := "SELECT name, type FROM system.columns WHERE database = ? AND table = ? AND default_kind NOT IN ('MATERIALIZED', 'ALIAS', 'EPHEMERAL') ORDER BY position"
+	rows, err := conn.Query(context.Background(), query, database, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	target := &targetTable{database: database, table: table}
+	for rows.Next() {
+		var columnName, columnType string
+		if err := rows.Scan(&columnName, &columnType); err != nil {
+			return nil, err
+		}
+		typ, err := generator.ParseColumnType(columnType)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %v", columnName, err)
+		}
+		target.columns = append(target.columns, tableColumn{name: columnName, typ: typ})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(target.columns) == 0 {
+		return nil, fmt.Errorf("table %s.%s does not exist or has no insertable columns", database, table)
+	}
+	return target, nil
+}
+
+func (t *targetTable) String() string {
+	return fmt.Sprintf("%s.%s", t.database, t.table)
+}
+
+func (t *targetTable) columnNames() []string {
+	names := make([]string, len(t.columns))
+	for i, column := range t.columns {
+		names[i] = column.name
+	}
+	return names
+}
+
+// generate draws one row, date and time columns take the timestamp
+func (t *targetTable) generate(r *rand.Rand, timestamp time.Time) ([]interface{}, int) {
+	row, total := make([]interface{}, len(t.columns)), 0
+	for i, column := range t.columns {
+		value, size := column.typ.Value(r, timestamp)
+		row[i], total = value, total+size
+	}
+	return row, total
+}
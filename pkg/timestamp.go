@@ -0,0 +1,151 @@
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pkg
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+const (
+	bucketTimestamps   = "bucket"
+	realtimeTimestamps = "realtime"
+	backfillTimestamps = "backfill"
+)
+
+// TimestampSpec decides the timestamps of the written rows. Buckets start at
+// the run start, at the wall clock or inside a backfill range, and rows can be
+// spaced, jittered or arrive late.
+type TimestampSpec struct {
+	Mode       string        `yaml:"mode"`
+	From       string        `yaml:"from"`        // backfill range start
+	To         string        `yaml:"to"`          // backfill range end, buckets wrap around when they pass it
+	BucketStep time.Duration `yaml:"bucket_step"` // time between two buckets
+	RowSpacing time.Duration `yaml:"row_spacing"` // time between two rows of a bucket
+	Jitter     time.Duration `yaml:"jitter"`      // every row moves by up to +/- jitter
+	LateRatio  float64       `yaml:"late_ratio"`  // share of rows that arrive late
+	LateBy     time.Duration `yaml:"late_by"`     // late rows are up to this much older
+
+	from time.Time
+	to   time.Time
+}
+
+func (s *TimestampSpec) validate() error {
+	if s.Mode == "" {
+		s.Mode = bucketTimestamps
+	}
+	if s.BucketStep == 0 {
+		s.BucketStep = time.Second
+	}
+	if s.BucketStep < 0 || s.RowSpacing < 0 || s.Jitter < 0 || s.LateBy < 0 {
+		return fmt.Errorf("bucket step, row spacing, jitter and late by must not be negative")
+	}
+	if s.LateRatio < 0 || s.LateRatio > 1 {
+		return fmt.Errorf("late ratio must be between 0 and 1: %v", s.LateRatio)
+	}
+	if s.LateRatio > 0 && s.LateBy == 0 {
+		return fmt.Errorf("late ratio requires late by")
+	}
+
+	switch s.Mode {
+	case bucketTimestamps, realtimeTimestamps:
+		if s.From != "" || s.To != "" {
+			return fmt.Errorf("from and to require the %s mode", backfillTimestamps)
+		}
+	case backfillTimestamps:
+		if s.From == "" {
+			return fmt.Errorf("the %s mode requires from", backfillTimestamps)
+		}
+		from, err := time.Parse(timeLayout, s.From)
+		if err != nil {
+			return fmt.Errorf("invalid from: %v", err)
+		}
+		s.from = from
+		if s.To != "" {
+			to, err := time.Parse(timeLayout, s.To)
+			if err != nil {
+				return fmt.Errorf("invalid to: %v", err)
+			}
+			if !to.After(from) {
+				return fmt.Errorf("to must be after from")
+			}
+			s.to = to
+		}
+	default:
+		return fmt.Errorf("invalid timestamp mode: %s", s.Mode)
+	}
+	return nil
+}
+
+// shaped reports whether rows get their own timestamps instead of the one of their bucket
+func (s *TimestampSpec) shaped() bool {
+	return s.RowSpacing > 0 || s.Jitter > 0 || s.LateRatio > 0
+}
+
+// bucket returns the base timestamp of a bucket
+func (s *TimestampSpec) bucket(startTime time.Time, bucket int) time.Time {
+	offset := time.Duration(bucket) * s.BucketStep
+	switch s.Mode {
+	case realtimeTimestamps:
+		return time.Now()
+	case backfillTimestamps:
+		if !s.to.IsZero() {
+			offset %= s.to.Sub(s.from)
+		}
+		return s.from.Add(offset)
+	default:
+		return startTime.Add(offset)
+	}
+}
+
+// row returns the timestamp of the row-th row of a bucket
+func (s *TimestampSpec) row(r *rand.Rand, bucket time.Time, row int) time.Time {
+	t := bucket.Add(time.Duration(row) * s.RowSpacing)
+	if s.Mode == realtimeTimestamps && row > 0 && s.RowSpacing == 0 {
+		t = time.Now()
+	}
+	if s.Jitter > 0 {
+		t = t.Add(time.Duration(r.Int63n(int64(2*s.Jitter)+1)) - s.Jitter)
+	}
+	if s.LateRatio > 0 && r.Float64() < s.LateRatio {
+		t = t.Add(-time.Duration(r.Int63n(int64(s.LateBy)) + 1))
+	}
+	return t
+}
+
+// bucketUnit describes how far apart the buckets are stamped
+func (s *TimestampSpec) bucketUnit() string {
+	if s.Mode == realtimeTimestamps {
+		return "wall clock (realtime)"
+	}
+	return fmt.Sprintf("%v per bucket (%s)", s.BucketStep, s.Mode)
+}
+
+func (s *TimestampSpec) String() string {
+	description := s.Mode
+	if s.Mode == backfillTimestamps {
+		description += fmt.Sprintf(" from %s", s.From)
+		if s.To != "" {
+			description += fmt.Sprintf(" to %s", s.To)
+		}
+	}
+	return fmt.Sprintf("%s, bucket step %v, row spacing %v, jitter %v, %.0f%% late by up to %v",
+		description, s.BucketStep, s.RowSpacing, s.Jitter, s.LateRatio*100, s.LateBy)
+}
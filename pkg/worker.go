@@ -0,0 +1,247 @@
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pkg
+
+import (
+	"context"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"clickhouse-benchmark/pkg/clickhouse"
+	"clickhouse-benchmark/pkg/show"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/cheggaaa/pb/v3"
+)
+
+// writeState is shared by all workers of one write run
+type writeState struct {
+	conn          driver.Conn
+	insertContext context.Context // carries the insert settings
+	opt           *WriteOption
+	startTime     time.Time
+	recorder      *throughputRecorder
+	bar           *pb.ProgressBar
+	debugInfo     *DebugAppendMetrics
+	latency       *latencyHistogram
+
+	inserts       int64
+	failedInserts int64
+	bytes         int64
+}
+
+// writeWorker appends the rows of its buckets into a batch and sends the batch
+// as soon as one of the flush thresholds is reached
+type writeWorker struct {
+	*writeState
+	batch      *clickhouse.Batch
+	batchCtx   context.Context // tags the insert of the batch with its query_id
+	preparedAt time.Time
+	flushTimer *time.Timer
+	generator  *metricGenerator
+	random     *rand.Rand
+	columns    *metricColumns // rows of the batch in column append mode, not yet in the batch
+}
+
+// run writes buckets until tasks is closed or ctx is done, buckets still
+// queued when ctx is done are left to the caller to count as dropped
+func (w *writeWorker) run(ctx context.Context, tasks <-chan writeTask) {
+	for {
+		select {
+		case <-ctx.Done():
+			w.flush()
+			return
+		case task, ok := <-tasks:
+			if !ok {
+				w.flush()
+				return
+			}
+			if ctx.Err() != nil {
+				w.recorder.Drop(w.opt.size)
+				w.flush()
+				return
+			}
+			w.writeBucket(task)
+		case <-w.flushDue():
+			w.flush()
+		}
+	}
+}
+
+func (w *writeWorker) writeBucket(task writeTask) {
+	//step concurrency
+	timestamp := w.opt.timestamps.bucket(w.startTime, task.bucket)
+
+	// Generate metrics data
+	for j := 0; j < w.opt.size; j++ {
+		if w.batch == nil && !w.prepare() {
+			return
+		}
+
+		t := timestamp
+		if w.opt.timestamps.shaped() || w.opt.timestamps.Mode == realtimeTimestamps {
+			t = w.opt.timestamps.row(w.rand(), timestamp, j)
+		}
+		err := w.append(t)
+		if w.bar != nil {
+			w.bar.Increment()
+		}
+		if err != nil {
+			show.Error("append is failed: %v", err)
+		}
+
+		if w.flushReached() {
+			w.flush()
+		}
+	}
+
+	// Without thresholds paced runs send every bucket on its own so the rate can be observed
+	if !w.opt.flushThresholds() && w.opt.paced() {
+		w.flush()
+	}
+}
+
+// append generates one row, a target table gets its values by column type
+func (w *writeWorker) append(timestamp time.Time) error {
+	if w.opt.target != nil {
+		row, size := w.opt.target.generate(w.rand(), timestamp)
+		return w.batch.AppendRow(size, row...)
+	}
+
+	metric := w.generate(timestamp)
+	if debugFlag {
+		w.debugInfo.Lock()
+		w.debugInfo.Add(metric)
+		w.debugInfo.Unlock()
+	}
+	if w.opt.appendMode == columnAppend {
+		if w.columns == nil {
+			w.columns = &metricColumns{}
+		}
+		w.columns.add(&metric)
+		return nil
+	}
+	return w.batch.AppendStruct(&metric)
+}
+
+// flushReached counts the buffered columns along with the rows already in the batch
+func (w *writeWorker) flushReached() bool {
+	rows, bytes := w.batch.TotalRows(), w.batch.TotalBytes()
+	if w.columns != nil {
+		rows += w.columns.rows
+		bytes += w.columns.bytes
+	}
+	return w.opt.flushReached(rows, bytes, w.batch.Age())
+}
+
+func (w *writeWorker) rand() *rand.Rand {
+	if w.random == nil {
+		w.random = rand.New(rand.NewSource(time.Now().UnixNano() + atomic.AddInt64(&seedOffset, 1)))
+	}
+	return w.random
+}
+
+// generate draws the metric from the generator spec, or builds the constant one without a spec
+func (w *writeWorker) generate(timestamp time.Time) Metric {
+	if w.opt.spec == nil {
+		return generateMetric(timestamp, w.opt.randomColumn)
+	}
+	if w.generator == nil {
+		w.generator = newMetricGenerator(w.opt.spec)
+	}
+	return w.generator.Generate(timestamp)
+}
+
+func (w *writeWorker) prepare() bool {
+	var (
+		batch *clickhouse.Batch
+		err   error
+	)
+	ctx := withQueryID(w.insertContext, "insert")
+	w.preparedAt = time.Now()
+	if w.opt.target != nil {
+		batch, err = clickhouse.PrepareColumns(ctx, w.conn, w.opt.target.database, w.opt.target.table, w.opt.target.columnNames())
+	} else {
+		batch, err = clickhouse.PrepareColumns(ctx, w.conn, databaseName, tableName, metricColumnNames)
+	}
+	if err != nil {
+		atomic.AddInt64(&w.failedInserts, 1)
+		show.Error("Failed to prepare batch: %v\n", err)
+		return false
+	}
+
+	w.batch, w.batchCtx = batch, ctx
+	if w.opt.flushInterval > 0 {
+		w.flushTimer = time.NewTimer(w.opt.flushInterval)
+	}
+	return true
+}
+
+// flushDue fires when the current batch is older than the flush interval
+func (w *writeWorker) flushDue() <-chan time.Time {
+	if w.flushTimer == nil {
+		return nil
+	}
+	return w.flushTimer.C
+}
+
+func (w *writeWorker) flush() {
+	if w.flushTimer != nil {
+		w.flushTimer.Stop()
+		w.flushTimer = nil
+	}
+	if w.batch == nil {
+		return
+	}
+
+	batch := w.batch
+	w.batch = nil
+	if w.columns != nil && w.columns.rows > 0 {
+		err := batch.AppendColumns(w.columns.rows, w.columns.bytes, w.columns.values()...)
+		w.columns.reset()
+		if err != nil {
+			atomic.AddInt64(&w.failedInserts, 1)
+			show.Error("Failed to append columns: %v\n", err)
+			batch.Abort()
+			return
+		}
+	}
+	rows, bytes := batch.TotalRows(), batch.TotalBytes()
+	if rows == 0 {
+		batch.Abort()
+		return
+	}
+
+	// Send the batch for execution
+	if !debugFlag {
+		start := time.Now()
+		if err := batch.Send(); err != nil {
+			atomic.AddInt64(&w.failedInserts, 1)
+			show.Error("Failed to send batch: %v\n", err)
+			return
+		}
+		w.latency.Add(time.Since(start))
+		// The server times the insert from the prepare on
+		recordQuery(w.batchCtx, time.Since(w.preparedAt))
+	}
+	atomic.AddInt64(&w.inserts, 1)
+	atomic.AddInt64(&w.bytes, int64(bytes))
+	w.recorder.Add(rows)
+}
@@ -0,0 +1,151 @@
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	ck "github.com/ClickHouse/clickhouse-go/v2"
+	"gopkg.in/yaml.v3"
+)
+
+const timeLayout = "2006-01-02 15:04:05"
+
+// Workload is a weighted mix of named read queries
+type Workload struct {
+	Queries  []WorkloadQuery   `yaml:"queries" json:"queries"`
+	Settings map[string]string `yaml:"settings" json:"settings"` // ClickHouse settings of every query
+
+	totalWeight float64
+}
+
+// WorkloadQuery is a query template, {start}, {end} and {step} are replaced
+// by the time step window and the step length in seconds
+type WorkloadQuery struct {
+	Name     string            `yaml:"name" json:"name"`
+	Weight   float64           `yaml:"weight" json:"weight"`
+	SQL      string            `yaml:"sql" json:"sql"`
+	Settings map[string]string `yaml:"settings" json:"settings"` // override the workload settings
+
+	settings ck.Settings
+}
+
+// loadWorkload reads a workload file, JSON when the extension is .json and YAML otherwise
+func loadWorkload(path string) (*Workload, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workload file: %v", err)
+	}
+
+	workload := &Workload{}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(content, workload)
+	} else {
+		err = yaml.Unmarshal(content, workload)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse workload file: %v", err)
+	}
+
+	if err := workload.validate(); err != nil {
+		return nil, err
+	}
+	return workload, nil
+}
+
+// newSingleQueryWorkload wraps the legacy --sql flag, which gets the time predicate appended
+func newSingleQueryWorkload(sql string, startTime, endTime time.Time) *Workload {
+	timeCondition := fmt.Sprintf("timestamp > '%s' AND timestamp < '%s'", startTime.Format(timeLayout), endTime.Format(timeLayout))
+	workload := &Workload{Queries: []WorkloadQuery{{
+		Name:   "default",
+		Weight: 1,
+		SQL:    sql + " WHERE " + timeCondition + " AND timestamp >= '{start}' and timestamp < '{end}'",
+	}}}
+	workload.totalWeight = 1
+	return workload
+}
+
+func (w *Workload) validate() error {
+	if len(w.Queries) == 0 {
+		return fmt.Errorf("workload has no queries")
+	}
+
+	names := make(map[string]bool)
+	w.totalWeight = 0
+	for i, query := range w.Queries {
+		if query.Name == "" {
+			return fmt.Errorf("workload query %d has no name", i+1)
+		}
+		if names[query.Name] {
+			return fmt.Errorf("duplicate workload query name: %s", query.Name)
+		}
+		names[query.Name] = true
+
+		if strings.TrimSpace(query.SQL) == "" {
+			return fmt.Errorf("workload query %s has no sql", query.Name)
+		}
+		if query.Weight < 0 {
+			return fmt.Errorf("workload query %s has a negative weight", query.Name)
+		}
+		w.totalWeight += query.Weight
+	}
+
+	if w.totalWeight <= 0 {
+		return fmt.Errorf("workload query weights add up to zero")
+	}
+	return nil
+}
+
+// applySettings resolves the settings of every query, the command settings
+// are overridden by the workload settings and those by the query settings
+func (w *Workload) applySettings(command ck.Settings) {
+	for i := range w.Queries {
+		query := &w.Queries[i]
+		query.settings = mergeSettings(command, settingsOf(w.Settings), settingsOf(query.Settings))
+	}
+}
+
+// pick chooses a query with a probability proportional to its weight
+func (w *Workload) pick(r *rand.Rand) *WorkloadQuery {
+	target := r.Float64() * w.totalWeight
+	for i := range w.Queries {
+		target -= w.Queries[i].Weight
+		if target < 0 {
+			return &w.Queries[i]
+		}
+	}
+	return &w.Queries[len(w.Queries)-1]
+}
+
+// render fills the placeholders of the query for one time step
+func (q *WorkloadQuery) render(start, end time.Time, step time.Duration) string {
+	replacer := strings.NewReplacer(
+		"{start}", start.Format(timeLayout),
+		"{end}", end.Format(timeLayout),
+		"{step}", strconv.FormatInt(int64(step/time.Second), 10),
+	)
+	return replacer.Replace(q.SQL)
+}
@@ -19,22 +19,55 @@
 package pkg
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"sync"
 	"time"
 
-	"clickhouse-benchmark/pkg/clickhouse"
+	"clickhouse-benchmark/pkg/report"
 	"clickhouse-benchmark/pkg/show"
 
+	ck "github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
 	"github.com/cheggaaa/pb/v3"
 	"github.com/spf13/cobra"
 )
 
+const (
+	closedLoop = "closed"
+	openLoop   = "open"
+
+	// openLoopQueue is how many scheduled buckets may wait for a free worker before new ones are dropped
+	openLoopQueue = 10000
+)
+
 type WriteOption struct {
 	bucketCount      int // bucket count like 30
 	size             int // bucket size like 100
 	concurrencyLimit int
 	randomColumn     bool
+	duration         time.Duration // keep writing until the duration elapses, ignores bucketCount
+	rate             int           // target rows per second, 0 means as fast as possible
+	rateTo           int           // ramp the rate linearly to this value over the duration, 0 disables
+	loop             string        // closed or open
+	reportInterval   time.Duration
+	flushRows        int           // send the batch after this many rows, 0 disables
+	flushBytes       int           // send the batch after this many uncompressed bytes, 0 disables
+	flushInterval    time.Duration // send the batch when it gets this old, 0 disables
+	generator        string        // generator spec file, empty keeps the constant metric
+	series           SeriesSpec    // fixed series population, overrides the one of the generator spec
+	timestamps       TimestampSpec // how the rows are spread over time
+	table            string        // target table as db.table, empty writes the metrics model
+	appendMode       string        // struct appends reflected rows, column appends whole columns
+	asyncInsert      string        // off, wait for the server buffer to flush, or nowait
+	asyncFlushWait   time.Duration // wait before counting the visible rows of an async run
+	settings         []string      // ClickHouse settings of the inserts as name=value
+	partsInterval    time.Duration // poll the parts of the target table, 0 disables
+
+	spec          *MetricSpec
+	target        *targetTable
+	querySettings ck.Settings
 }
 
 var writeOpt WriteOption
@@ -43,7 +76,7 @@ var writeCommand = &cobra.Command{
 	Use:  "write",
 	Long: ` write some data to clickhouse`,
 	Run: func(cmd *cobra.Command, args []string) {
-		if err := writeToClickhouse(); err != nil {
+		if err := writeToClickhouse(cmd); err != nil {
 			show.Error("Error: %v\n", err)
 			os.Exit(1)
 		}
@@ -55,102 +88,482 @@ func init() {
 	writeCommand.Flags().IntVarP(&writeOpt.bucketCount, "bucket", "b", 100, "bucket count like 30")
 	writeCommand.Flags().IntVarP(&writeOpt.size, "size", "n", 1, "bucket size like 100")
 	writeCommand.Flags().IntVarP(&writeOpt.concurrencyLimit, "concurrency", "c", 1, "concurrency limit like 1")
-	writeCommand.Flags().BoolVarP(&writeOpt.randomColumn, "random", "rdm", false, "random column")
+	writeCommand.Flags().BoolVar(&writeOpt.randomColumn, "random", false, "random column")
+	writeCommand.Flags().DurationVarP(&writeOpt.duration, "duration", "d", 0, "run time like 30m, overrides the bucket count")
+	writeCommand.Flags().IntVarP(&writeOpt.rate, "rate", "r", 0, "target rows per second, 0 means unlimited")
+	writeCommand.Flags().IntVar(&writeOpt.rateTo, "rate-to", 0, "ramp the rate linearly to this value over the duration, 0 disables")
+	writeCommand.Flags().StringVar(&writeOpt.loop, "loop", closedLoop, "closed: wait for a free worker before scheduling the next bucket, open: schedule buckets at the target rate regardless")
+	writeCommand.Flags().DurationVar(&writeOpt.reportInterval, "report-interval", 10*time.Second, "interval of the achieved rate report")
+	writeCommand.Flags().IntVar(&writeOpt.flushRows, "flush-rows", 0, "send the batch after this many rows, 0 disables")
+	writeCommand.Flags().IntVar(&writeOpt.flushBytes, "flush-bytes", 0, "send the batch after this many uncompressed bytes, 0 disables")
+	writeCommand.Flags().DurationVar(&writeOpt.flushInterval, "flush-interval", 0, "send the batch when it gets this old like 500ms, 0 disables")
+	writeCommand.Flags().StringVarP(&writeOpt.generator, "generator", "g", "", "YAML or JSON generator spec with per column value distributions")
+	writeCommand.Flags().Int64Var(&writeOpt.series.Count, "series", 0, "number of distinct series the rows cycle through, 0 disables")
+	writeCommand.Flags().Int64Var(&writeOpt.series.MetricGroups, "metric-groups", 0, "distinct metric groups among the series, defaults to 1")
+	writeCommand.Flags().Int64Var(&writeOpt.series.TagKeySets, "tag-key-sets", 0, "distinct tag key sets among the series, defaults to 1")
+	writeCommand.Flags().IntVar(&writeOpt.series.Tags, "tags-per-series", 0, "tags of every series, defaults to 2")
+	writeCommand.Flags().StringVar(&writeOpt.timestamps.Mode, "timestamp-mode", bucketTimestamps, "bucket (run start + bucket step), realtime (wall clock) or backfill (from --from)")
+	writeCommand.Flags().StringVar(&writeOpt.timestamps.From, "from", "", "backfill range start like 2023-06-09 18:00:00")
+	writeCommand.Flags().StringVar(&writeOpt.timestamps.To, "to", "", "backfill range end, buckets wrap around when they pass it")
+	writeCommand.Flags().DurationVar(&writeOpt.timestamps.BucketStep, "bucket-step", time.Second, "time between two buckets")
+	writeCommand.Flags().DurationVar(&writeOpt.timestamps.RowSpacing, "row-spacing", 0, "time between two rows of a bucket like 10ms, 0 keeps the bucket timestamp")
+	writeCommand.Flags().DurationVar(&writeOpt.timestamps.Jitter, "jitter", 0, "move every row by up to +/- this duration")
+	writeCommand.Flags().Float64Var(&writeOpt.timestamps.LateRatio, "late-ratio", 0, "share of rows between 0 and 1 that arrive out of order")
+	writeCommand.Flags().DurationVar(&writeOpt.timestamps.LateBy, "late-by", 0, "late rows are up to this much older than their bucket")
+	writeCommand.Flags().StringVar(&writeOpt.appendMode, "append", structAppend, "struct appends every row by reflection, column buffers the batch as column slices")
+	writeCommand.Flags().StringVar(&writeOpt.asyncInsert, "async-insert", asyncInsertOff, "off, wait (async_insert with wait_for_async_insert) or nowait (fire and forget)")
+	writeCommand.Flags().DurationVar(&writeOpt.asyncFlushWait, "async-flush-wait", 5*time.Second, "wait this long after an async run before counting the visible rows")
+	writeCommand.Flags().StringVarP(&writeOpt.table, "table", "t", "", "write generated rows into any table as db.table, its columns are read from system.columns")
+	addSettingsFlag(writeCommand, &writeOpt.settings)
+	writeCommand.Flags().DurationVar(&writeOpt.partsInterval, "parts-interval", 10*time.Second, "poll the parts and merges of the target table at this interval, 0 disables")
+	addQueryLogFlag(writeCommand)
+	addSamplerFlag(writeCommand)
+	addOutputFlags(writeCommand)
+}
+
+func (o *WriteOption) validate() error {
+	if o.size <= 0 || o.concurrencyLimit <= 0 {
+		return fmt.Errorf("size and concurrency must be positive")
+	}
+	if o.rate < 0 {
+		return fmt.Errorf("invalid rate: %d", o.rate)
+	}
+	if o.rateTo < 0 || (o.rateTo > 0 && (o.rate == 0 || o.duration == 0)) {
+		return fmt.Errorf("rate-to requires a rate and a duration")
+	}
+	if o.flushRows < 0 || o.flushBytes < 0 || o.flushInterval < 0 {
+		return fmt.Errorf("flush thresholds must not be negative")
+	}
+	if err := o.timestamps.validate(); err != nil {
+		return err
+	}
+	switch o.appendMode {
+	case structAppend:
+	case columnAppend:
+		if o.table != "" {
+			return fmt.Errorf("column append only supports the metrics model, not --table")
+		}
+		if protocol, _ := connProtocol(); protocol == httpProtocol {
+			return fmt.Errorf("column append is not supported over HTTP")
+		}
+	default:
+		return fmt.Errorf("invalid append mode: %s", o.appendMode)
+	}
+	switch o.asyncInsert {
+	case asyncInsertOff, asyncInsertWait, asyncInsertNoWait:
+	default:
+		return fmt.Errorf("invalid async insert mode: %s", o.asyncInsert)
+	}
+	if o.asyncFlushWait < 0 || o.partsInterval < 0 {
+		return fmt.Errorf("async flush wait and parts interval must not be negative")
+	}
+	settings, err := parseSettings(o.settings)
+	if err != nil {
+		return err
+	}
+	o.querySettings = mergeSettings(o.querySettings, settings)
+	if o.table != "" {
+		if _, _, err := parseTableName(o.table); err != nil {
+			return err
+		}
+		if o.generator != "" || o.series.Count > 0 {
+			return fmt.Errorf("generator and series only apply to the metrics model, not to --table")
+		}
+	}
+	if o.generator != "" && o.spec == nil {
+		spec, err := loadMetricSpec(o.generator)
+		if err != nil {
+			return err
+		}
+		o.spec = spec
+	}
+	if o.series.Count > 0 {
+		if o.spec == nil {
+			o.spec = defaultMetricSpec()
+			if err := o.spec.validate(); err != nil {
+				return err
+			}
+		}
+		series := o.series
+		if err := series.validate(); err != nil {
+			return fmt.Errorf("series: %v", err)
+		}
+		o.spec.Series = &series
+	}
+
+	switch o.loop {
+	case closedLoop:
+	case openLoop:
+		if o.rate == 0 {
+			return fmt.Errorf("open loop requires a target rate")
+		}
+	default:
+		return fmt.Errorf("invalid loop: %s", o.loop)
+	}
+	return nil
 }
 
-func writeToClickhouse() error {
+// loadTable introspects the target table once there is a connection
+func (o *WriteOption) loadTable(conn driver.Conn) error {
+	if o.table == "" || o.target != nil {
+		return nil
+	}
+	target, err := loadTargetTable(conn, o.table)
+	if err != nil {
+		return err
+	}
+	o.target = target
+	return nil
+}
+
+// paced reports whether buckets are sent one by one instead of once per worker at the end
+func (o *WriteOption) paced() bool {
+	return o.duration > 0 || o.rate > 0
+}
+
+// flushThresholds reports whether any flush threshold is set. Without one a
+// worker sends once at the end, or once per bucket in paced runs.
+func (o *WriteOption) flushThresholds() bool {
+	return o.flushRows > 0 || o.flushBytes > 0 || o.flushInterval > 0
+}
+
+// flushReached reports whether a batch hit the row, byte or age threshold, whichever comes first
+func (o *WriteOption) flushReached(rows, bytes int, age time.Duration) bool {
+	return (o.flushRows > 0 && rows >= o.flushRows) ||
+		(o.flushBytes > 0 && bytes >= o.flushBytes) ||
+		(o.flushInterval > 0 && age >= o.flushInterval)
+}
+
+type writeTask struct {
+	bucket    int
+	scheduled time.Time
+}
+
+// writeResult is the outcome of one write run
+type writeResult struct {
+	elapsed       time.Duration
+	rows          int64
+	bytes         int64
+	inserts       int64
+	failedInserts int64
+	dropped       int64
+	intervals     []IntervalStat
+	latency       *latencyHistogram
+	cpu           time.Duration // client CPU time of the process, 0 when unknown
+	appendMode    string
+	asyncInsert   string
+
+	visibleChecked bool
+	visibleRows    int64 // rows the table gained after the async flush wait
+}
+
+func writeToClickhouse(cmd *cobra.Command) error {
+	if err := writeOpt.validate(); err != nil {
+		return err
+	}
+	if err := outputOpt.validate(); err != nil {
+		return err
+	}
+
 	conn, err := getConn(os.Getenv("CLICKHOUSE_URL"))
 	if err != nil {
 		return err
 	}
 	defer conn.Close()
+	if err := writeOpt.loadTable(conn); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if writeOpt.duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, writeOpt.duration)
+		defer cancel()
+	}
+
+	// Async inserts are acknowledged before they are visible, count what actually arrived
+	checkVisible := writeOpt.asyncInsert != asyncInsertOff && !debugFlag
+	var before uint64
+	if checkVisible {
+		database, table := writeOpt.insertTable()
+		if before, err = countRows(conn, database, table); err != nil {
+			return err
+		}
+	}
+
+	document := newResult(cmd, conn, time.Now())
+	sampler := startServerSampler(conn, document.StartedAt)
+	parts := startPartsTracker(conn, &writeOpt, document.StartedAt)
+	result := runWrite(ctx, conn, &writeOpt)
+	sampler.Stop()
+	parts.Stop()
+	if checkVisible {
+		if result.visibleRows, err = visibleRows(conn, &writeOpt, before); err != nil {
+			return err
+		}
+		result.visibleChecked = true
+	}
+
+	// Print benchmarking results
+	show.Info("ClickHouse URL: %s", os.Getenv("CLICKHOUSE_URL"))
+	if writeOpt.duration > 0 {
+		show.Info("Benchmarking Duration: %v", writeOpt.duration)
+	} else {
+		show.Info("Benchmarking Bucket Count: %d", writeOpt.bucketCount)
+	}
+	show.Info("Benchmarking Size: %d", writeOpt.size)
+	show.Info("Benchmarking Concurrency: %v", writeOpt.concurrencyLimit)
+	show.Info("Benchmarking Bucket Unit: %s", writeOpt.timestamps.bucketUnit())
+	if writeOpt.target != nil {
+		show.Info("Benchmarking Table: %s, %d columns", writeOpt.target, len(writeOpt.target.columns))
+	}
+	if writeOpt.generator != "" {
+		show.Info("Benchmarking Generator: %s", writeOpt.generator)
+	}
+	if spec := writeOpt.spec; spec != nil && spec.Series != nil {
+		show.Info("Benchmarking Series: %d, %d metric groups, %d tag key sets, %d tags per series",
+			spec.Series.Count, spec.Series.MetricGroups, spec.Series.TagKeySets, spec.Series.Tags)
+	}
+	show.Info("Benchmarking Timestamps: %s", writeOpt.timestamps.String())
+	if writeOpt.flushThresholds() {
+		show.Info("Benchmarking Flush: %d rows, %d bytes, %v", writeOpt.flushRows, writeOpt.flushBytes, writeOpt.flushInterval)
+	}
+	if writeOpt.asyncInsert != asyncInsertOff {
+		show.Info("Benchmarking Async Insert: %s", writeOpt.asyncInsert)
+	}
+	if len(writeOpt.querySettings) > 0 {
+		show.Info("Benchmarking Settings: %s", formatSettings(writeOpt.querySettings))
+	}
+	if writeOpt.rateTo > 0 {
+		show.Info("Benchmarking Rate: %d to %d rows/s, %s loop", writeOpt.rate, writeOpt.rateTo, writeOpt.loop)
+	} else if writeOpt.rate > 0 {
+		show.Info("Benchmarking Rate: %d rows/s, %s loop", writeOpt.rate, writeOpt.loop)
+	}
+	show.EmptyLine()
 
+	result.print(&writeOpt)
+	sampler.print()
+	parts.print()
+
+	result.addTo(document, "", document.StartedAt)
+	sampler.addTo(document)
+	parts.addTo(document)
+	captureServerStats(conn, document)
+	return publishResult(conn, document)
+}
+
+// runWrite writes buckets until all of them are written or, with a duration, until ctx is done
+func runWrite(ctx context.Context, conn driver.Conn, opt *WriteOption) *writeResult {
 	startTime := time.Now()
+	startCPU, cpuKnown := processCPUTime()
 	// Calculate the total number of data records
-	totalRecords := writeOpt.size * writeOpt.bucketCount
+	totalRecords := opt.size * opt.bucketCount
 
 	debugInfo := NewDebugAppendMetrics()
 
-	wg := sync.WaitGroup{}
-	wg.Add(writeOpt.concurrencyLimit)
+	// Closed loop hands a bucket over only when a worker is free, open loop queues it
+	queue := 0
+	if opt.loop == openLoop {
+		queue = openLoopQueue
+	}
+	tasks := make(chan writeTask, queue)
 
-	bar := pb.StartNew(totalRecords)
+	limiter := newPacer(float64(opt.rate))
+	if opt.rateTo > 0 {
+		go limiter.Ramp(ctx, float64(opt.rate), float64(opt.rateTo), opt.duration)
+	}
 
-	for i := 1; i <= writeOpt.concurrencyLimit; i++ {
-		batch, err := clickhouse.Prepare(conn, databaseName, tableName)
-		if err != nil {
-			return err
-		}
+	reportInterval := time.Duration(0)
+	if opt.paced() {
+		reportInterval = opt.reportInterval
+	}
+	recorder := newThroughputRecorder(reportInterval, limiter.Rate, func() int { return len(tasks) })
 
-		// Start a goroutine to process each batch
-		go func(step int) {
-			defer func() {
-				wg.Done()
-			}()
+	var bar *pb.ProgressBar
+	if opt.duration == 0 {
+		bar = pb.StartNew(totalRecords)
+	}
 
-			// Generate data for each bucket
-			for bucket := step; bucket <= writeOpt.bucketCount*writeOpt.concurrencyLimit; bucket += writeOpt.concurrencyLimit {
-				if bucket > writeOpt.bucketCount {
-					break
-				}
-				//step concurrency
-				timestamp := startTime.Add(time.Duration(bucket) * time.Second)
-
-				// Generate metrics data
-				for j := 0; j < writeOpt.size; j++ {
-					//t := timestamp.Add(time.Duration(j) * time.Second)
-					t := timestamp
-					metric := generateMetric(t, writeOpt.randomColumn)
-					err := batch.AppendStruct(&metric)
-					bar.Increment()
-					if debugFlag {
-						debugInfo.Lock()
-						debugInfo.Add(metric)
-						debugInfo.Unlock()
-					}
-
-					if err != nil {
-						show.Error("append is failed: %v", err)
-					}
-				}
-			}
+	state := &writeState{
+		conn:          conn,
+		insertContext: opt.insertContext(),
+		opt:           opt,
+		startTime:     startTime,
+		recorder:      recorder,
+		bar:           bar,
+		debugInfo:     debugInfo,
+		latency:       newLatencyHistogram(),
+	}
+
+	recorder.Start()
 
-			// Send the batch for execution
-			if debugFlag {
+	// Schedule the buckets
+	go func() {
+		defer close(tasks)
+		for bucket := 1; opt.duration > 0 || bucket <= opt.bucketCount; bucket++ {
+			scheduled, err := limiter.Wait(ctx, opt.size)
+			if err != nil {
 				return
 			}
 
-			err := batch.Send()
-			if err != nil {
-				show.Error("Failed to send batch: %v\n", err)
+			task := writeTask{bucket: bucket, scheduled: scheduled}
+			if opt.loop == openLoop {
+				select {
+				case tasks <- task:
+				default:
+					recorder.Drop(opt.size)
+				}
+				continue
+			}
+
+			select {
+			case tasks <- task:
+			case <-ctx.Done():
 				return
 			}
-		}(i)
+		}
+	}()
+
+	wg := sync.WaitGroup{}
+	wg.Add(opt.concurrencyLimit)
+
+	for i := 1; i <= opt.concurrencyLimit; i++ {
+		// Start a goroutine to process the buckets
+		go func() {
+			defer func() {
+				wg.Done()
+			}()
+
+			worker := &writeWorker{writeState: state}
+			worker.run(ctx, tasks)
+		}()
 	}
 
 	// Wait for all batches to complete
 	wg.Wait()
 
-	bar.Finish()
+	// The run ends with ctx, the buckets still queued in open loop are dropped
+	for range tasks {
+		recorder.Drop(opt.size)
+	}
+
+	result := &writeResult{
+		intervals:     recorder.Stop(),
+		rows:          recorder.Total(),
+		bytes:         state.bytes,
+		inserts:       state.inserts,
+		failedInserts: state.failedInserts,
+		latency:       state.latency,
+		appendMode:    opt.appendMode,
+		asyncInsert:   opt.asyncInsert,
+	}
+	if endCPU, ok := processCPUTime(); ok && cpuKnown {
+		result.cpu = endCPU - startCPU
+	}
+	for _, interval := range result.intervals {
+		result.dropped += interval.Dropped
+	}
+
+	if bar != nil {
+		bar.Finish()
+	}
 	if debugFlag {
 		debugInfo.Printf()
 	}
 
 	// Perform benchmarking calculations
-	elapsedTime := time.Since(startTime)
-	completeRequests := totalRecords / writeOpt.size
+	result.elapsed = time.Since(startTime)
+	return result
+}
 
-	// Print benchmarking results
-	show.Info("ClickHouse URL: %s", os.Getenv("CLICKHOUSE_URL"))
-	show.Info("Benchmarking Bucket Count: %d", writeOpt.bucketCount)
-	show.Info("Benchmarking Size: %d", writeOpt.size)
-	show.Info("Benchmarking Concurrency: %v", writeOpt.concurrencyLimit)
-	show.Info("Benchmarking Bucket Unit: %s", "Seconds")
+func (r *writeResult) print(opt *WriteOption) {
+	show.Info("Time taken for tests: %v", r.elapsed)
+	show.Info("Complete requests: %d", r.rows/int64(opt.size))
+	show.Info("Complete inserts: %d", r.inserts)
+	show.Info("Failed inserts: %d", r.failedInserts)
+	show.Info("Total rows written: %d", r.rows)
+	show.Info("Total bytes written: %.2f MB (uncompressed)", float64(r.bytes)/1024/1024)
+	if r.inserts > 0 {
+		show.Info("Average rows per insert: %d", r.rows/r.inserts)
+	}
+	show.Info("Rows per second: %.0f", r.rowsPerSecond())
+	show.Info("Bytes per second: %.2f MB/s (uncompressed)", float64(r.bytes)/1024/1024/r.elapsed.Seconds())
+	show.Info("Inserts per second: %.2f", float64(r.inserts)/r.elapsed.Seconds())
+	if opt.paced() && opt.loop == openLoop {
+		show.Info("Dropped rows: %d", r.dropped)
+	}
+	if r.cpu > 0 {
+		show.Info("Client CPU time: %v, %v per million rows (%s append)", r.cpu.Round(time.Millisecond), r.cpuPerMillionRows().Round(time.Millisecond), r.appendMode)
+	}
+	if r.visibleChecked {
+		show.Info("Visible rows after %v: %d of %d (%.1f%%)", opt.asyncFlushWait, r.visibleRows, r.rows, r.visibleRatio()*100)
+	}
 	show.EmptyLine()
 
-	show.Info("Time taken for tests: %v", elapsedTime)
-	show.Info("Complete requests: %d", completeRequests)
-	show.Info("Total transferred: %d", totalRecords) // Update this based on the actual transferred data size
+	if r.asyncInsert != "" && r.asyncInsert != asyncInsertOff {
+		r.latency.Print("Async insert ack")
+		return
+	}
+	r.latency.Print("Insert")
+}
 
-	return nil
+// addTo adds the metrics and the interval series to the result document,
+// the names get the prefix and the offsets are measured from clock
+func (r *writeResult) addTo(result *report.Result, prefix string, clock time.Time) {
+	seconds := r.elapsed.Seconds()
+	result.AddMetric(prefix+"write_elapsed", seconds, "s", false)
+	result.AddMetric(prefix+"rows_written", float64(r.rows), "rows", true)
+	result.AddMetric(prefix+"bytes_written", float64(r.bytes), "bytes", true)
+	result.AddMetric(prefix+"inserts", float64(r.inserts), "inserts", true)
+	result.AddMetric(prefix+"failed_inserts", float64(r.failedInserts), "inserts", false)
+	result.AddMetric(prefix+"dropped_rows", float64(r.dropped), "rows", false)
+	result.AddMetric(prefix+"rows_per_second", r.rowsPerSecond(), "rows/s", true)
+	result.AddMetric(prefix+"bytes_per_second", float64(r.bytes)/seconds, "bytes/s", true)
+	result.AddMetric(prefix+"inserts_per_second", float64(r.inserts)/seconds, "inserts/s", true)
+	if r.cpu > 0 {
+		result.AddMetric(prefix+"client_cpu_seconds", r.cpu.Seconds(), "s", false)
+		result.AddMetric(prefix+"client_cpu_seconds_per_million_rows", r.cpuPerMillionRows().Seconds(), "s", false)
+	}
+	if r.visibleChecked {
+		result.AddMetric(prefix+"visible_rows", float64(r.visibleRows), "rows", true)
+		result.AddMetric(prefix+"visible_rows_ratio", r.visibleRatio(), "ratio", true)
+	}
+	r.latency.Summary().addMetrics(result, prefix+"insert")
+
+	if len(r.intervals) == 0 {
+		return
+	}
+	series := report.Series{
+		Name:   prefix + "write_intervals",
+		Fields: []string{"rows", "requested_rows_per_second", "achieved_rows_per_second", "backlog", "dropped_rows"},
+	}
+	for _, interval := range r.intervals {
+		end := interval.Start.Add(interval.Elapsed)
+		series.Points = append(series.Points, report.Point{
+			Time:   end,
+			Offset: end.Sub(clock).Seconds(),
+			Values: []float64{float64(interval.Rows), interval.Requested, interval.Achieved, float64(interval.Backlog), float64(interval.Dropped)},
+		})
+	}
+	result.Series = append(result.Series, series)
+}
+
+// visibleRatio is the share of the acknowledged rows that became visible
+func (r *writeResult) visibleRatio() float64 {
+	if r.rows == 0 {
+		return 0
+	}
+	return float64(r.visibleRows) / float64(r.rows)
+}
+
+// cpuPerMillionRows tells whether a run measured the server or the client
+func (r *writeResult) cpuPerMillionRows() time.Duration {
+	if r.rows == 0 {
+		return 0
+	}
+	return time.Duration(float64(r.cpu) / float64(r.rows) * 1e6)
+}
+
+func (r *writeResult) rowsPerSecond() float64 {
+	return float64(r.rows) / r.elapsed.Seconds()
 }